@@ -0,0 +1,78 @@
+package shexec_test
+
+import (
+	"strconv"
+	"testing"
+
+	. "github.com/monopole/shexec"
+	"github.com/monopole/shexec/channeler"
+)
+
+const (
+	// benchRowsPerQuery is the number of rows conch emits per Run.
+	benchRowsPerQuery = 100000
+	// benchRowsInDb is large enough to never run dry during a benchmark,
+	// since conch decrements its row count as rows are printed.
+	benchRowsInDb = 1 << 30
+)
+
+// startBenchConch starts a conch shell with a huge fake database.
+func startBenchConch(b *testing.B) Shell {
+	b.Helper()
+	sh := NewShell(Parameters{
+		Params: channeler.Params{
+			WorkingDir: "./conch",
+			Path:       "go",
+			Args: []string{
+				"run", ".",
+				"--disable-prompt",
+				"--num-rows-in-db", strconv.Itoa(benchRowsInDb),
+			}},
+		SentinelOut: sentinelVersion,
+		SentinelErr: sentinelUnknownCommand,
+	})
+	if err := sh.Start(timeOutLong); err != nil {
+		b.Fatal(err)
+	}
+	return sh
+}
+
+// BenchmarkRunLargeQueryDiscard measures the raw cost of moving
+// output through the infrastructure.
+func BenchmarkRunLargeQueryDiscard(b *testing.B) {
+	sh := startBenchConch(b)
+	c := &DiscardCommander{
+		C: "query limit " + strconv.Itoa(benchRowsPerQuery)}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := sh.Run(timeOutLong*5, c); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	if err := sh.Stop(timeOutLong, ""); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkRunLargeQueryRecall is like BenchmarkRunLargeQueryDiscard,
+// but retains every line.
+func BenchmarkRunLargeQueryRecall(b *testing.B) {
+	sh := startBenchConch(b)
+	c := NewRecallCommander("query limit " + strconv.Itoa(benchRowsPerQuery))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Reset()
+		if err := sh.Run(timeOutLong*5, c); err != nil {
+			b.Fatal(err)
+		}
+		if len(c.DataOut()) != benchRowsPerQuery {
+			b.Fatalf("expected %d rows, got %d",
+				benchRowsPerQuery, len(c.DataOut()))
+		}
+	}
+	b.StopTimer()
+	if err := sh.Stop(timeOutLong, ""); err != nil {
+		b.Fatal(err)
+	}
+}
@@ -0,0 +1,140 @@
+package shexec
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// BinaryOutputter is an optional extension of Commander, for a command
+// with binary output, e.g. "cat image.png" or "tar c dir".
+//
+// If BinaryOutput returns true, the parsers get the command's output
+// exactly as the shell wrote it, newlines, carriage returns, NULs and
+// all, in Write calls whose boundaries needn't fall between lines.
+// LineWriter isn't used.  Binary output needs the Shell to run in
+// control mode (see channeler.Params.ControlFD), so that no sentinel
+// is mixed into the data; otherwise Run fails.  Merger isn't
+// supported.  OutputLimits count bytes, and lines by their newlines,
+// and output is cut exactly at a limit.
+type BinaryOutputter interface {
+	BinaryOutput() bool
+}
+
+// BinaryCommander gives a Commander binary output.
+// The wrapped Commander's other extensions still apply.
+type BinaryCommander struct {
+	Commander
+}
+
+func (c *BinaryCommander) BinaryOutput() bool { return true }
+func (c *BinaryCommander) Unwrap() Commander  { return c.Commander }
+
+// BinaryError is returned by Run when a Commander wants binary
+// output that can't be had.  The command isn't sent, and the shell
+// remains ready for another.
+type BinaryError struct {
+	// Command is the (abbreviated) command.
+	Command string
+	// Reason says why binary output can't be had.
+	Reason string
+}
+
+func (e *BinaryError) Error() string {
+	return fmt.Sprintf(
+		"%s; binary output of %q %s", errCategory, e.Command, e.Reason)
+}
+
+// isBinary is true if the Commander wants binary output.
+func isBinary(c Commander) bool {
+	b, ok := extension[BinaryOutputter](c)
+	return ok && b.BinaryOutput()
+}
+
+// checkBinary returns a *BinaryError if the Commander
+// wants binary output that can't be had.
+func (eInf *execInfra) checkBinary(c Commander) error {
+	if !isBinary(c) {
+		return nil
+	}
+	if !eInf.inControl() {
+		return &BinaryError{
+			Command: eInf.lgr.abbrev(c.Command()), Reason: "needs control mode"}
+	}
+	if _, ok := extension[Merger](c); ok {
+		return &BinaryError{
+			Command: eInf.lgr.abbrev(c.Command()), Reason: "can't be merged"}
+	}
+	return nil
+}
+
+// scanRaw passes a stream's output to the parser as read, up to a
+// boundary.  It's the scan used for binary output, needing no
+// sentinel value.  If ds is not nil, it's shown the output as lines.
+func scanRaw(
+	stream *streamCursor,
+	parser io.WriteCloser,
+	_ []byte,
+	ds *dialogSide,
+) error {
+	name, lgr := stream.name, stream.lgr
+	lgr.Printf("scan %s; awaiting binary output", name)
+	for {
+		data, ok := stream.nextRaw(ds)
+		if !ok {
+			break
+		}
+		if _, err := parser.Write(data); err != nil {
+			return shErrCaused(
+				err, "problem writing %d bytes to %s parser", len(data), name)
+		}
+	}
+	if err := parser.Close(); err != nil {
+		return shErrCaused(err, "problem closing %s parser", name)
+	}
+	if !stream.takeBoundary() {
+		if stream.stopped() {
+			return shErr("%s scan stopped", name)
+		}
+		return shErr("%s closed before command completed", name)
+	}
+	lgr.Printf("scan %s; reached boundary, closed", name)
+	return nil
+}
+
+// writeRaw forwards binary output until a limit is hit.
+func (lp *limitedParser) writeRaw(data []byte) error {
+	if lp.truncated {
+		return nil
+	}
+	keep := data
+	if m := lp.limits.MaxBytes; m > 0 && lp.bytes+int64(len(keep)) > m {
+		keep = keep[:m-lp.bytes]
+	}
+	if m := lp.limits.MaxLines; m > 0 {
+		for i := 0; i < len(keep); {
+			if lp.lines == m {
+				keep = keep[:i]
+				break
+			}
+			j := bytes.IndexByte(keep[i:], newLineChar)
+			if j < 0 {
+				break
+			}
+			lp.lines++
+			i += j + 1
+		}
+	}
+	lp.bytes += int64(len(keep))
+	if len(keep) > 0 {
+		if _, err := lp.WriteCloser.Write(keep); err != nil {
+			//nolint:wrapcheck
+			return err
+		}
+	}
+	if len(keep) < len(data) {
+		lp.truncated = true
+		lp.onTruncate()
+	}
+	return nil
+}
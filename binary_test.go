@@ -0,0 +1,126 @@
+package shexec_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	. "github.com/monopole/shexec"
+	"github.com/monopole/shexec/channeler"
+	"github.com/stretchr/testify/assert"
+)
+
+// bytesCommander records the bytes of its output.
+type bytesCommander struct {
+	c        string
+	out, err bytesParser
+	limits   OutputLimits
+}
+
+func (c *bytesCommander) Command() string            { return c.c }
+func (c *bytesCommander) ParseOut() io.WriteCloser   { return &c.out }
+func (c *bytesCommander) ParseErr() io.WriteCloser   { return &c.err }
+func (c *bytesCommander) BinaryOutput() bool         { return true }
+func (c *bytesCommander) OutputLimits() OutputLimits { return c.limits }
+
+type bytesParser struct{ bytes.Buffer }
+
+// timedCommander notes when its first output arrived.
+type timedCommander struct {
+	bytesCommander
+	first time.Time
+}
+
+func (c *timedCommander) ParseOut() io.WriteCloser { return c }
+func (c *timedCommander) Close() error             { return nil }
+func (c *timedCommander) Write(data []byte) (int, error) {
+	if c.first.IsZero() {
+		c.first = time.Now()
+	}
+	return c.out.Write(data) //nolint:wrapcheck
+}
+
+func (p *bytesParser) Close() error { return nil }
+
+func TestBinaryOutput(t *testing.T) {
+	sh := NewShell(Parameters{
+		Params: channeler.Params{Path: "/bin/sh", ControlFD: true},
+	})
+	assert.NoError(t, sh.Start(timeOutShort))
+
+	c := &bytesCommander{
+		c: `printf 'a\r\nb\000c\n\n\r'; printf 'x\ry' 1>&2`}
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	assert.Equal(t, "a\r\nb\x00c\n\n\r", c.out.String())
+	assert.Equal(t, "x\ry", c.err.String())
+
+	// Every byte value, many times over.
+	c = &bytesCommander{c: `i=0; while [ $i -lt 4096 ]; do
+printf "$(printf '\\%o' $((i % 256)))"; i=$((i+1)); done`}
+	assert.NoError(t, sh.Run(timeOutLong, c))
+	want := make([]byte, 4096)
+	for i := range want {
+		want[i] = byte(i % 256)
+	}
+	assert.Equal(t, want, c.out.Bytes())
+
+	// Limits cut the output exactly.
+	c = &bytesCommander{
+		c: `printf 'one\ntwo\nthree'`, limits: OutputLimits{MaxLines: 2}}
+	var te *TruncationError
+	assert.True(t, errors.As(sh.Run(timeOutShort, c), &te))
+	assert.Equal(t, "one\ntwo\n", c.out.String())
+	c = &bytesCommander{
+		c: `printf 'one\ntwo\nthree'`, limits: OutputLimits{MaxBytes: 5}}
+	assert.True(t, errors.As(sh.Run(timeOutShort, c), &te))
+	assert.Equal(t, "one\nt", c.out.String())
+
+	// Output lacking newlines is streamed, not held back, and limits
+	// apply to it as it comes.
+	tc := &timedCommander{bytesCommander: bytesCommander{
+		c:      `printf abc; sleep 1; head -c 1000000 /dev/zero`,
+		limits: OutputLimits{MaxBytes: 10},
+	}}
+	start := time.Now()
+	assert.True(t, errors.As(sh.Run(timeOutLong, tc), &te))
+	assert.Less(t, tc.first.Sub(start), 500*time.Millisecond)
+	assert.Equal(t, "abc\x00\x00\x00\x00\x00\x00\x00", tc.out.String())
+
+	// Lines work as before.
+	rc := NewRecallCommander(`printf 'a\r\nb'`)
+	assert.NoError(t, sh.Run(timeOutShort, rc))
+	assert.Equal(t, []string{"a", "b"}, rc.DataOut())
+	assert.NoError(t, sh.Stop(timeOutShort, ""))
+
+	// Without control mode, there's no binary output.
+	sh = NewShell(makeBinShParams())
+	assert.NoError(t, sh.Start(timeOutShort))
+	err := sh.Run(timeOutShort, &BinaryCommander{
+		Commander: NewRecallCommander("echo hi")})
+	var be *BinaryError
+	if assert.True(t, errors.As(err, &be)) {
+		assert.Equal(t, "echo hi", be.Command)
+		assert.Contains(t, err.Error(), "needs control mode")
+	}
+	// The command wasn't sent, and the shell is fine.
+	rc = NewRecallCommander("echo hello")
+	assert.NoError(t, sh.Run(timeOutShort, rc))
+	assert.Equal(t, []string{"hello"}, rc.DataOut())
+	assert.NoError(t, sh.Stop(timeOutShort, ""))
+}
+
+func TestBinaryCommanderKeepsExtensions(t *testing.T) {
+	sh := NewShell(Parameters{
+		Params: channeler.Params{Path: "/bin/sh", ControlFD: true},
+	})
+	assert.NoError(t, sh.Start(timeOutShort))
+	c := &statusCommander{
+		RecallCommander: NewRecallCommander("echo hi; (exit 3)"),
+		status:          -99,
+	}
+	assert.NoError(t, sh.Run(timeOutShort, &BinaryCommander{Commander: c}))
+	assert.Equal(t, 3, c.status)
+	assert.NoError(t, sh.Stop(timeOutShort, ""))
+}
@@ -0,0 +1,264 @@
+package shexec
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+const (
+	// blockKeyTag and blockValueTag are `shexec` tag values, and map
+	// keys, that refer to a Block's own key and value, rather than
+	// to a child's.
+	blockKeyTag   = "#key"
+	blockValueTag = "#value"
+)
+
+// Block is a line of block-structured output, together with the
+// more deeply indented lines that follow it, e.g.
+//
+//	Findleblaster hizod f068ec82_6d28_5a3d11ac_1555eaa0 ---
+//	  golattice vplm policy VPLM_Replication
+//	  created 12/22/2017 2:11:12 PM
+//
+// is a Block with key "Findleblaster" and two children, the first
+// with key "golattice" and value "vplm policy VPLM_Replication".
+type Block struct {
+	Key   string
+	Value string
+	// Line is the 1-relative line number in the command's output.
+	Line     int
+	Children []*Block
+	// text is the line, less indentation.
+	text string
+}
+
+// Child returns the first child with the given key, ignoring case,
+// or nil if there's no such child.
+func (b *Block) Child(key string) *Block {
+	for _, c := range b.Children {
+		if strings.EqualFold(c.Key, key) {
+			return c
+		}
+	}
+	return nil
+}
+
+// Map returns the block as a map.  The block's own key and value
+// are under "#key" and "#value".  Each child appears under its key,
+// as its value if it has no children, else as a map.  A repeated key
+// maps to a []any holding all its values.
+func (b *Block) Map() map[string]any {
+	m := map[string]any{blockKeyTag: b.Key, blockValueTag: b.Value}
+	for _, c := range b.Children {
+		var v any = c.Value
+		if len(c.Children) > 0 {
+			v = c.Map()
+		}
+		switch prev := m[c.Key].(type) {
+		case nil:
+			m[c.Key] = v
+		case []any:
+			m[c.Key] = append(prev, v)
+		default:
+			m[c.Key] = []any{prev, v}
+		}
+	}
+	return m
+}
+
+// BlockCommander parses block-structured stdOut, where an unindented
+// header line is followed by indented "key value" lines, which may
+// themselves have more deeply indented lines.  The output may hold
+// any number of such blocks.
+//
+// Each block yields a T, which is either map[string]any (see
+// Block.Map), or a struct whose fields are matched to child keys
+// by a `shexec` tag or by name, ignoring case (see tagKey).
+// A struct field gets the child's value, converted to the field's
+// type, unless the field is itself a struct, in which case it's
+// filled from the child's children.  A slice field gets all the
+// children with the key.  Use tags "#key" and "#value" for the
+// block's own key and value.  Fields without a matching child are
+// left alone.
+//
+// Blocks that cannot be converted don't fail the call to Run;
+// they're reported by Err.
+// Each Run replaces the results of the previous one.
+type BlockCommander[T any] struct {
+	C string
+	// Separator splits a key from its value.  If empty, the key
+	// is the first word on the line, and the value is the rest.
+	// A line lacking the separator is all key.
+	Separator string
+
+	blocks  []*Block
+	records []T
+	errs    parseErrors
+}
+
+// NewBlockCommander returns an instance of BlockCommander.
+func NewBlockCommander[T any](c string, sep string) *BlockCommander[T] {
+	return &BlockCommander[T]{C: c, Separator: sep}
+}
+
+func (c *BlockCommander[T]) Command() string          { return c.C }
+func (c *BlockCommander[T]) ParseErr() io.WriteCloser { return DevNull }
+func (c *BlockCommander[T]) ParseOut() io.WriteCloser {
+	c.blocks, c.records, c.errs = nil, nil, nil
+	return &blockParser[T]{c: c}
+}
+
+// Blocks returns the top level blocks.
+func (c *BlockCommander[T]) Blocks() []*Block { return c.blocks }
+
+// Records returns a T for each top level block.
+func (c *BlockCommander[T]) Records() []T { return c.records }
+
+// Err returns an error for each block that could not be converted.
+func (c *BlockCommander[T]) Err() error { return c.errs.err() }
+
+// Result returns the records, and the error from Err.
+func (c *BlockCommander[T]) Result() ([]T, error) {
+	return c.records, c.Err()
+}
+
+func (c *BlockCommander[T]) split(text string) (key, value string) {
+	if c.Separator == "" {
+		i := strings.IndexAny(text, " \t")
+		if i < 0 {
+			return text, ""
+		}
+		return text[:i], strings.TrimSpace(text[i:])
+	}
+	key, value, _ = strings.Cut(text, c.Separator)
+	return strings.TrimSpace(key), strings.TrimSpace(value)
+}
+
+// blockParser assembles Blocks as lines arrive.
+type blockParser[T any] struct {
+	c    *BlockCommander[T]
+	line int
+	// stack holds the blocks that might yet get children,
+	// with their indentation.
+	stack []indentedBlock
+}
+
+type indentedBlock struct {
+	indent int
+	b      *Block
+}
+
+func (bp *blockParser[T]) Write(data []byte) (int, error) {
+	bp.line++
+	body := strings.TrimLeft(string(data), " \t")
+	text := strings.TrimRight(body, " \t")
+	if text == "" {
+		return len(data), nil
+	}
+	indent := len(data) - len(body)
+	b := &Block{Line: bp.line, text: text}
+	b.Key, b.Value = bp.c.split(text)
+	for len(bp.stack) > 0 && bp.stack[len(bp.stack)-1].indent >= indent {
+		bp.stack = bp.stack[:len(bp.stack)-1]
+	}
+	if len(bp.stack) == 0 {
+		bp.c.blocks = append(bp.c.blocks, b)
+	} else {
+		parent := bp.stack[len(bp.stack)-1].b
+		parent.Children = append(parent.Children, b)
+	}
+	bp.stack = append(bp.stack, indentedBlock{indent, b})
+	return len(data), nil
+}
+
+func (bp *blockParser[T]) Close() error {
+	for _, b := range bp.c.blocks {
+		rec, err := decodeBlock[T](b)
+		if err != nil {
+			bp.c.errs.add(b.Line, b.text, err)
+			continue
+		}
+		bp.c.records = append(bp.c.records, rec)
+	}
+	return nil
+}
+
+func decodeBlock[T any](b *Block) (result T, err error) {
+	v := reflect.ValueOf(&result).Elem()
+	if v.Type() == reflect.TypeOf(map[string]any{}) {
+		v.Set(reflect.ValueOf(b.Map()))
+		return
+	}
+	err = fillFromBlock(v, b)
+	return
+}
+
+// fillFromBlock sets v from the block; from its children if v is
+// a struct, else from its value.
+func fillFromBlock(v reflect.Value, b *Block) error {
+	if v.Kind() == reflect.Pointer {
+		p := reflect.New(v.Type().Elem())
+		if err := fillFromBlock(p.Elem(), b); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	if v.Kind() == reflect.Struct {
+		if _, ok := v.Addr().Interface().(encoding.TextUnmarshaler); !ok {
+			return fillStructFromBlock(v, b)
+		}
+	}
+	return setField(v, b.Value)
+}
+
+func fillStructFromBlock(v reflect.Value, b *Block) error {
+	t := v.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, tagged := f.Tag.Lookup(tagKey)
+		if !tagged {
+			name = f.Name
+		}
+		var err error
+		switch name {
+		case "-":
+			continue
+		case blockKeyTag:
+			err = setField(v.Field(i), b.Key)
+		case blockValueTag:
+			err = setField(v.Field(i), b.Value)
+		default:
+			err = fillFieldFromChildren(v.Field(i), b, name)
+		}
+		if err != nil {
+			return fmt.Errorf("field %s; %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func fillFieldFromChildren(v reflect.Value, b *Block, key string) error {
+	isList := v.Kind() == reflect.Slice &&
+		v.Type().Elem().Kind() != reflect.Uint8
+	for _, c := range b.Children {
+		if !strings.EqualFold(c.Key, key) {
+			continue
+		}
+		if !isList {
+			return fillFromBlock(v, c)
+		}
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := fillFromBlock(elem, c); err != nil {
+			return fmt.Errorf("line %d; %w", c.Line, err)
+		}
+		v.Set(reflect.Append(v, elem))
+	}
+	return nil
+}
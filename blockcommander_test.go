@@ -0,0 +1,118 @@
+package shexec_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/monopole/shexec"
+	"github.com/stretchr/testify/assert"
+)
+
+// busInfo is what conch prints in response to "print bus <id>".
+type busInfo struct {
+	Name     string `shexec:"#key"`
+	Summary  string `shexec:"#value"`
+	Policy   string `shexec:"golattice"`
+	Created  string
+	Modified string
+	Society  string
+	Project  string
+	Locking  string
+}
+
+func TestBlockCommanderConch(t *testing.T) {
+	sh := NewShell(makeConchParams())
+	assert.NoError(t, sh.Start(timeOutLong))
+	defer func() { assert.NoError(t, sh.Stop(timeOutShort, "")) }()
+
+	c := NewBlockCommander[busInfo]("print bus 1\nprint bus 2", "")
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	assert.NoError(t, c.Err())
+	expected := busInfo{
+		Name:     "Findleblaster",
+		Summary:  "hizod f068ec82_6d28_5a3d11ac_1555eaa0 ---",
+		Policy:   "vplm policy VPLM_Replication",
+		Created:  "12/22/2017 2:11:12 PM",
+		Modified: "12/22/2017 2:11:45 PM",
+		Society:  "poet",
+		Project:  "ManufacturingEngineeringCS",
+		Locking:  "not enforced",
+	}
+	assert.Equal(t, []busInfo{expected, expected}, c.Records())
+	if assert.Len(t, c.Blocks(), 2) {
+		b := c.Blocks()[1]
+		assert.Equal(t, 9, b.Line)
+		assert.Len(t, b.Children, 7)
+		assert.Equal(t, "unlocked", b.Child("RANDOMLY").Value)
+	}
+
+	m := NewBlockCommander[map[string]any]("print bus 1", "")
+	assert.NoError(t, sh.Run(timeOutShort, m))
+	if assert.Len(t, m.Records(), 1) {
+		assert.Equal(t, "poet", m.Records()[0]["society"])
+		assert.Equal(t, "Findleblaster", m.Records()[0]["#key"])
+	}
+
+	// A failed lookup writes only to stdErr.
+	c.C = "print bus 100000"
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	assert.NoError(t, c.Err())
+	assert.Empty(t, c.Records())
+}
+
+func TestBlockCommanderNested(t *testing.T) {
+	sh := NewShell(makeBinShParams())
+	assert.NoError(t, sh.Start(timeOutShort))
+	defer func() { assert.NoError(t, sh.Stop(timeOutShort, "")) }()
+
+	type disk struct {
+		Device string `shexec:"#value"`
+		SizeGB int    `shexec:"size"`
+	}
+	type host struct {
+		Name  string `shexec:"#value"`
+		Cores int
+		Disks []disk `shexec:"disk"`
+		Net   struct {
+			Addr string
+			Up   bool
+		}
+	}
+	c := NewBlockCommander[host](`cat <<'EOF'
+host: alpha
+  cores: 4
+  disk: sda
+    size: 100
+  disk: sdb
+    size: 200
+  net:
+    addr: 10.0.0.1
+    up: true
+
+host: beta
+  cores: many
+EOF`, ":")
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	if assert.Len(t, c.Records(), 1) {
+		h := c.Records()[0]
+		assert.Equal(t, "alpha", h.Name)
+		assert.Equal(t, 4, h.Cores)
+		assert.Equal(t, []disk{{"sda", 100}, {"sdb", 200}}, h.Disks)
+		assert.Equal(t, "10.0.0.1", h.Net.Addr)
+		assert.True(t, h.Net.Up)
+	}
+	var pe *ParseError
+	if assert.True(t, errors.As(c.Err(), &pe)) {
+		assert.Equal(t, 11, pe.Line)
+		assert.Equal(t, "host: beta", pe.Text)
+		assert.Contains(t, pe.Error(), "field Cores")
+	}
+
+	m := NewBlockCommander[map[string]any](c.C, ":")
+	assert.NoError(t, sh.Run(timeOutShort, m))
+	if assert.Len(t, m.Records(), 2) {
+		disks := m.Records()[0]["disk"].([]any)
+		assert.Len(t, disks, 2)
+		assert.Equal(t, "200", disks[1].(map[string]any)["size"])
+	}
+}
@@ -1,5 +1,7 @@
 package channeler
 
+import "io"
+
 // Channels holds a shell's input and output channels.
 type Channels struct {
 	// StdIn accepts command lines. A "command line" is opaque;
@@ -14,8 +16,38 @@ type Channels struct {
 	// with the content of StdErr; the latter is merely another
 	// output stream from the subprocess.
 	Done <-chan error
-	// StdOut provides lines from stdout with NewLine removed.
-	StdOut <-chan string
-	// StdErr provides lines from stderr with NewLine removed.
-	StdErr <-chan string
+	// StdOut provides lines from stdout with NewLine removed,
+	// batched into Chunks. The receiver should Release each Chunk.
+	// A Chunk with no lines means only part of a line arrived;
+	// the rest of the line comes in a later Chunk.  The part
+	// so far is available from the Chunk's Partial method.
+	StdOut <-chan *Chunk
+	// StdErr is like StdOut, except for stderr.
+	StdErr <-chan *Chunk
+	// Feed, if not nil, copies everything from the reader to the
+	// shell's stdin, as is, following whatever was sent on StdIn
+	// before the call.  It returns once the copy is done, so the
+	// pace is set by the shell's consumption of the data.
+	Feed func(io.Reader) error
+	// Control, if not nil, provides the lines the shell writes to
+	// its control pipe; see Params.ControlFD.  It closes when the
+	// shell exits.
+	Control <-chan string
+	// Mark, if not nil, asks for a Chunk with Boundary set on both
+	// StdOut and StdErr, following all output the shell wrote before
+	// the call.  A command's output can thus be delimited without
+	// sentinels in the output: have the shell report the command's
+	// completion on the control pipe, then call Mark.
+	Mark func()
+	// Binary, if not nil, sets whether output is binary.  Binary
+	// output is delivered as it's read, rather than held until a
+	// newline; data lacking one arrives as a line without its
+	// terminator, holding at most one read's worth of bytes.  Chunk.Raw
+	// then yields the output exactly.  It's meant for use with Mark,
+	// since binary output can't hold sentinels.
+	Binary func(on bool)
+	// Interrupt, if not nil, sends an interrupt signal to the shell.
+	// What happens next is up to the shell; a REPL will typically
+	// abandon the command in progress, while many shells just exit.
+	Interrupt func() error
 }
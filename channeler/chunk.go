@@ -0,0 +1,165 @@
+package channeler
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// chunkCapacity is the initial data capacity of a Chunk.
+	// It matches the size of a stream read, so a Chunk usually
+	// holds everything that arrived in one read.
+	chunkCapacity = readBufSize
+
+	// chunkCapacityMax is the largest buffer a Chunk may have and still
+	// be returned to the pool; bigger ones are left to the collector.
+	chunkCapacityMax = 16 * chunkCapacity
+
+	// chunkLinesGuess is how many lines to make room for in a new Chunk.
+	chunkLinesGuess = 512
+)
+
+// Chunk holds one or more consecutive lines read from one of the
+// subprocess' output streams.  Lines lack their terminators, but
+// the bytes as read, terminators included, are available from Raw.
+// All lines in a Chunk share a Stream and a Time, and have
+// consecutive sequence numbers.
+//
+// Chunks are pooled to keep allocations off the data path.
+// Whoever receives a Chunk owns it, and should call Release when
+// done with it.  Slices returned by Line must not be retained
+// after Release.
+type Chunk struct {
+	// data holds the lines as read; line i is data[starts[i]:ends[i]],
+	// and its terminator, if any, runs to the start of the next line.
+	data     []byte
+	starts   []int
+	ends     []int
+	partial  []byte
+	boundary bool
+	stream   Stream
+	time     time.Time
+	firstSeq uint64
+}
+
+// nolint:gochecknoglobals
+var chunkPool = sync.Pool{
+	New: func() any {
+		return &Chunk{
+			data:   make([]byte, 0, chunkCapacity),
+			starts: make([]int, 0, chunkLinesGuess),
+			ends:   make([]int, 0, chunkLinesGuess),
+		}
+	},
+}
+
+// newChunk returns an empty Chunk from the pool.
+func newChunk() *Chunk {
+	//nolint:forcetypeassert
+	c := chunkPool.Get().(*Chunk)
+	c.data = c.data[:0]
+	c.starts = c.starts[:0]
+	c.ends = c.ends[:0]
+	c.partial = c.partial[:0]
+	c.boundary = false
+	c.stream, c.time, c.firstSeq = StreamUnknown, time.Time{}, 0
+	return c
+}
+
+// NewChunk returns a Chunk holding the given lines, each read
+// as if terminated by a newline.
+// It's meant for tests that drive Channels by hand.
+func NewChunk(lines ...string) *Chunk {
+	c := newChunk()
+	for _, l := range lines {
+		c.appendRaw([]byte(l + "\n"))
+	}
+	return c
+}
+
+// Len returns the number of lines in the Chunk.
+func (c *Chunk) Len() int { return len(c.ends) }
+
+// Line returns the i-th line in the Chunk, 0 <= i < Len().
+func (c *Chunk) Line(i int) []byte {
+	return c.data[c.starts[i]:c.ends[i]:c.ends[i]]
+}
+
+// Raw returns the bytes read for the Chunk's lines from the i-th
+// on, line terminators included, 0 <= i <= Len().  Raw(0) holds
+// all the lines.  A stream's output is exactly the concatenation
+// of its Chunks' Raw(0); an unterminated line is included once
+// it's ended by a newline, a boundary or the end of the stream.
+func (c *Chunk) Raw(i int) []byte {
+	if i >= len(c.starts) {
+		return c.data[len(c.data):]
+	}
+	return c.data[c.starts[i]:]
+}
+
+// rawLine returns the bytes read for the i-th line.
+func (c *Chunk) rawLine(i int) []byte {
+	if i+1 < len(c.starts) {
+		return c.data[c.starts[i]:c.starts[i+1]]
+	}
+	return c.data[c.starts[i]:]
+}
+
+// Record returns the i-th line in the Chunk, with its metadata.
+func (c *Chunk) Record(i int) Line {
+	seq := c.firstSeq
+	if seq > 0 {
+		seq += uint64(i)
+	}
+	return Line{Text: c.Line(i), Stream: c.stream, Time: c.time, Seq: seq}
+}
+
+// Partial returns the start of an unterminated line that followed
+// the Chunk's lines when the Chunk was made, e.g. a prompt awaiting
+// an answer.  The text isn't a line; once the line is complete, it's
+// delivered in a later Chunk, starting with this text.
+func (c *Chunk) Partial() []byte { return c.partial }
+
+// Boundary is true if the Chunk ends the output written before a
+// call to Channels.Mark.  Any unterminated line at that point is
+// the Chunk's last line.
+func (c *Chunk) Boundary() bool { return c.boundary }
+
+// Stream returns the stream the Chunk's lines came from.
+func (c *Chunk) Stream() Stream { return c.stream }
+
+// Size returns the number of bytes read into
+// the Chunk, line terminators included.
+func (c *Chunk) Size() int { return len(c.data) }
+
+// Release returns the Chunk to the pool.
+func (c *Chunk) Release() {
+	if cap(c.data) > chunkCapacityMax {
+		return
+	}
+	chunkPool.Put(c)
+}
+
+// stamp sets the Chunk's metadata, drawing sequence
+// numbers for its lines from the given counter.
+func (c *Chunk) stamp(s Stream, t time.Time, counter *atomic.Uint64) {
+	c.stream, c.time = s, t
+	if n := uint64(len(c.ends)); n > 0 {
+		c.firstSeq = counter.Add(n) - n + 1
+	}
+}
+
+// appendRaw appends a line as read.  A terminating newline, and any
+// carriage return preceding it, are kept in the data but not the line.
+// A lone carriage return ending an unterminated line is treated alike.
+func (c *Chunk) appendRaw(raw []byte) {
+	text := raw
+	if n := len(text); n > 0 && text[n-1] == newLineChar {
+		text = text[:n-1]
+	}
+	text = dropCR(text)
+	c.starts = append(c.starts, len(c.data))
+	c.ends = append(c.ends, len(c.data)+len(text))
+	c.data = append(c.data, raw...)
+}
@@ -0,0 +1,22 @@
+// Package channeler wires up a command-line shell with channels.
+// See README.md.
+//
+// # Migrating from string channels
+//
+// Channels.StdOut and Channels.StdErr once delivered one string per
+// line.  They now deliver pooled *Chunk values, each holding the lines
+// from one read, so a receiver that looped over lines becomes:
+//
+//	for c := range chs.StdOut {
+//		for i := 0; i < c.Len(); i++ {
+//			handle(string(c.Line(i)))
+//		}
+//		c.Release()
+//	}
+//
+// A line's bytes belong to the Chunk, and are reused once it's
+// released, so copy any line kept longer, e.g. with string(...) as
+// above.  A Chunk with no lines is not the end of the stream; it
+// signals a partial line (see Chunk.Partial).  The channels still
+// close when the shell's output ends.
+package channeler
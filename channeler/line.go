@@ -0,0 +1,47 @@
+package channeler
+
+import (
+	"time"
+)
+
+// Stream identifies one of the subprocess' output streams.
+type Stream int
+
+const (
+	// StreamUnknown is the zero value, e.g. in a Chunk made by NewChunk.
+	StreamUnknown Stream = iota
+	// StreamOut is stdout.
+	StreamOut
+	// StreamErr is stderr.
+	StreamErr
+)
+
+func (s Stream) String() string {
+	switch s {
+	case StreamOut:
+		return "stdOut"
+	case StreamErr:
+		return "stdErr"
+	case StreamUnknown:
+	}
+	return "unknown"
+}
+
+// Line is a line of output, with NewLine removed, plus
+// metadata describing where and when it arrived.
+type Line struct {
+	// Text is the line itself.  It must not be retained beyond
+	// the call that received the Line; copy it if needed.
+	Text []byte
+	// Stream is the stream the line came from.
+	Stream Stream
+	// Time is when the line was read from the stream.
+	Time time.Time
+	// Seq is a sequence number, starting at 1, assigned as lines
+	// are read, and shared by stdout and stderr.  Comparing Seq
+	// values of lines from different streams yields the best
+	// available guess at the order in which the subprocess wrote them.
+	// Lines read at the same moment, e.g. in one read from a stream,
+	// get consecutive Seq values.
+	Seq uint64
+}
@@ -0,0 +1,160 @@
+package channeler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// readBufSize is the initial size of a lineReader's buffer.
+	readBufSize = 64 * 1024
+
+	carriageReturnChar = '\r'
+)
+
+// lineReader reads a stream, batching the lines it finds into Chunks.
+//
+// Lines are split the way bufio.ScanLines splits them; the terminator
+// is an optional carriage return followed by a newline, and a final
+// unterminated line is still a line.  Unlike bufio.Scanner there's no
+// limit on line length; the buffer grows as needed.  In binary mode,
+// though, data not ending in a newline is passed on as read, so the
+// buffer never grows.
+type lineReader struct {
+	rd     io.Reader
+	stream Stream
+	// seq is shared with the reader of the other stream.
+	seq *atomic.Uint64
+	// buf holds data read from rd; buf[start:end] is not yet consumed.
+	buf        []byte
+	start, end int
+	eof        bool
+	err        error
+	// marker and raw, if not nil, support marks; see Channels.Mark.
+	marker markable
+	raw    syscall.RawConn
+	// marks counts requested boundaries not yet delivered.
+	marks atomic.Int32
+	// binary is true if output is binary; see Channels.Binary.
+	binary atomic.Bool
+}
+
+func newLineReader(
+	rd io.Reader, s Stream, seq *atomic.Uint64) *lineReader {
+	return &lineReader{
+		rd: rd, stream: s, seq: seq, buf: make([]byte, readBufSize)}
+}
+
+// Err returns the first non-EOF error encountered reading the stream.
+func (lr *lineReader) Err() error { return lr.err }
+
+// next returns a Chunk holding all the complete lines obtained
+// from one read, or nil if the stream is done.
+// If the read obtained only part of a line, the Chunk is empty;
+// it serves to signal that the stream is active.  Either way, the
+// Chunk's Partial holds the start of the unterminated line, if any.
+func (lr *lineReader) next() *Chunk {
+	c := lr.read()
+	if c != nil {
+		c.stamp(lr.stream, time.Now(), lr.seq)
+	}
+	return c
+}
+
+func (lr *lineReader) read() *Chunk {
+	for !lr.eof {
+		if lr.marks.Load() > 0 {
+			return lr.boundary()
+		}
+		lr.makeRoom()
+		n, err := lr.rd.Read(lr.buf[lr.end:])
+		lr.end += n
+		if err != nil && !lr.wasWoken(err) {
+			if !errors.Is(err, io.EOF) {
+				lr.err = err
+			}
+			lr.eof = true
+			break
+		}
+		c := lr.splitLines()
+		if lr.binary.Load() && lr.start < lr.end {
+			// Binary output isn't held awaiting a newline.
+			if c == nil {
+				c = newChunk()
+			}
+			c.appendRaw(lr.buf[lr.start:lr.end])
+			lr.start = lr.end
+		}
+		if c != nil {
+			return lr.withPartial(c)
+		}
+		if n > 0 {
+			return lr.withPartial(newChunk())
+		}
+	}
+	c := lr.splitLines()
+	if lr.start < lr.end {
+		// Final line lacks a newline.
+		if c == nil {
+			c = newChunk()
+		}
+		c.appendRaw(lr.buf[lr.start:lr.end])
+		lr.start = lr.end
+	}
+	return c
+}
+
+// makeRoom assures there's space at the end of buf for a read.
+func (lr *lineReader) makeRoom() {
+	if lr.start == lr.end {
+		lr.start, lr.end = 0, 0
+		return
+	}
+	if lr.end < len(lr.buf) {
+		return
+	}
+	if lr.start > 0 {
+		lr.end = copy(lr.buf, lr.buf[lr.start:lr.end])
+		lr.start = 0
+		return
+	}
+	// A single line fills the buffer.
+	bigger := make([]byte, 2*len(lr.buf))
+	copy(bigger, lr.buf)
+	lr.buf = bigger
+}
+
+// withPartial copies any unterminated line into the Chunk.
+func (lr *lineReader) withPartial(c *Chunk) *Chunk {
+	c.partial = append(c.partial, lr.buf[lr.start:lr.end]...)
+	return c
+}
+
+// splitLines moves all complete lines from buf into a new Chunk.
+// Returns nil if there are no complete lines.
+func (lr *lineReader) splitLines() *Chunk {
+	var c *Chunk
+	for {
+		i := bytes.IndexByte(lr.buf[lr.start:lr.end], newLineChar)
+		if i < 0 {
+			return c
+		}
+		if c == nil {
+			c = newChunk()
+		}
+		c.appendRaw(lr.buf[lr.start : lr.start+i+1])
+		lr.start += i + 1
+	}
+}
+
+// dropCR drops a terminal carriage return from the data.
+func dropCR(data []byte) []byte {
+	if len(data) > 0 && data[len(data)-1] == carriageReturnChar {
+		return data[0 : len(data)-1]
+	}
+	return data
+}
@@ -0,0 +1,191 @@
+package channeler
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLineReader(rd io.Reader) *lineReader {
+	return newLineReader(rd, StreamOut, new(atomic.Uint64))
+}
+
+func readAllLines(lr *lineReader) (lines []string) {
+	for c := lr.next(); c != nil; c = lr.next() {
+		for i := 0; i < c.Len(); i++ {
+			lines = append(lines, string(c.Line(i)))
+		}
+		c.Release()
+	}
+	return
+}
+
+func TestLineReader(t *testing.T) {
+	long := strings.Repeat("x", 3*readBufSize+7)
+	testCases := map[string]struct {
+		input    string
+		expected []string
+	}{
+		"empty": {
+			input: "",
+		},
+		"oneNewLine": {
+			input:    "\n",
+			expected: []string{""},
+		},
+		"noFinalNewLine": {
+			input:    "hello\nthere",
+			expected: []string{"hello", "there"},
+		},
+		"finalNewLine": {
+			input:    "hello\nthere\n",
+			expected: []string{"hello", "there"},
+		},
+		"blankLines": {
+			input:    "hello\n\n\nthere\n",
+			expected: []string{"hello", "", "", "there"},
+		},
+		"carriageReturns": {
+			input:    "hello\r\nthere\r\nsailor\r",
+			expected: []string{"hello", "there", "sailor"},
+		},
+		"embeddedCarriageReturn": {
+			input:    "hel\rlo\n",
+			expected: []string{"hel\rlo"},
+		},
+		"longLine": {
+			input:    "a\n" + long + "\nb\n",
+			expected: []string{"a", long, "b"},
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			lr := newTestLineReader(strings.NewReader(tc.input))
+			assert.Equal(t, tc.expected, readAllLines(lr))
+			assert.NoError(t, lr.Err())
+			// Read a byte at a time to exercise partial lines.
+			lr = newTestLineReader(
+				iotest.OneByteReader(strings.NewReader(tc.input)))
+			assert.Equal(t, tc.expected, readAllLines(lr))
+			assert.NoError(t, lr.Err())
+		})
+	}
+}
+
+func TestLineReaderError(t *testing.T) {
+	oops := errors.New("oops")
+	lr := newTestLineReader(io.MultiReader(
+		strings.NewReader("hello\nthere"), iotest.ErrReader(oops)))
+	assert.Equal(t, []string{"hello", "there"}, readAllLines(lr))
+	assert.ErrorIs(t, lr.Err(), oops)
+}
+
+func TestLineReaderPartial(t *testing.T) {
+	lr := newTestLineReader(
+		iotest.OneByteReader(strings.NewReader("ab\nOK? ")))
+	var partials []string
+	for c := lr.next(); c != nil; c = lr.next() {
+		partials = append(partials, string(c.Partial()))
+		c.Release()
+	}
+	assert.Equal(t,
+		[]string{"a", "ab", "", "O", "OK", "OK?", "OK? ", ""}, partials)
+
+	// The partial line survives a trip through a spill file.
+	c := NewChunk("x")
+	c.partial = append(c.partial, "Password: "...)
+	d, err := decodeChunk(encodeChunk(nil, c)[spillHeaderLen:])
+	assert.NoError(t, err)
+	assert.Equal(t, "Password: ", string(d.Partial()))
+	c.Release()
+	d.Release()
+}
+
+func TestLineReaderRaw(t *testing.T) {
+	const data = "a\r\nb\x00c\n\n\rd\r\re"
+	lr := newTestLineReader(iotest.HalfReader(strings.NewReader(data)))
+	var (
+		raw   []byte
+		lines []string
+	)
+	for c := lr.next(); c != nil; c = lr.next() {
+		raw = append(raw, c.Raw(0)...)
+		for i := 0; i < c.Len(); i++ {
+			lines = append(lines, string(c.Line(i)))
+		}
+		c.Release()
+	}
+	assert.Equal(t, data, string(raw))
+	assert.Equal(t, []string{"a", "b\x00c", "", "\rd\r\re"}, lines)
+
+	// Raw bytes survive a trip through a spill file.
+	c := newChunk()
+	c.appendRaw([]byte("x\r\n"))
+	c.appendRaw([]byte("y\n"))
+	c.appendRaw([]byte("z\r"))
+	d, err := decodeChunk(encodeChunk(nil, c)[spillHeaderLen:])
+	assert.NoError(t, err)
+	assert.Equal(t, "x\r\ny\nz\r", string(d.Raw(0)))
+	assert.Equal(t, "y\nz\r", string(d.Raw(1)))
+	assert.Empty(t, d.Raw(3))
+	assert.Equal(t, "z", string(d.Line(2)))
+	c.Release()
+	d.Release()
+}
+
+func TestLineReaderMetadata(t *testing.T) {
+	var seq atomic.Uint64
+	before := time.Now()
+	lrOut := newLineReader(strings.NewReader("a\nb\n"), StreamOut, &seq)
+	lrErr := newLineReader(strings.NewReader("c\n"), StreamErr, &seq)
+
+	c := lrOut.next()
+	assert.Equal(t, StreamOut, c.Stream())
+	assert.Equal(t, 2, c.Len())
+	r0, r1 := c.Record(0), c.Record(1)
+	assert.Equal(t, "a", string(r0.Text))
+	assert.Equal(t, uint64(1), r0.Seq)
+	assert.Equal(t, uint64(2), r1.Seq)
+	assert.Equal(t, StreamOut, r1.Stream)
+	assert.False(t, r0.Time.Before(before))
+	assert.Equal(t, r0.Time, r1.Time)
+	c.Release()
+
+	c = lrErr.next()
+	r := c.Record(0)
+	assert.Equal(t, "c", string(r.Text))
+	assert.Equal(t, StreamErr, r.Stream)
+	assert.Equal(t, uint64(3), r.Seq)
+
+	// Metadata survives a trip through a spill file.
+	d, err := decodeChunk(encodeChunk(nil, c)[spillHeaderLen:])
+	assert.NoError(t, err)
+	assert.Equal(t, r.Stream, d.Record(0).Stream)
+	assert.Equal(t, r.Seq, d.Record(0).Seq)
+	assert.True(t, r.Time.Equal(d.Record(0).Time))
+	assert.Equal(t, "c", string(d.Line(0)))
+	c.Release()
+	d.Release()
+}
+
+func TestLineReaderBinary(t *testing.T) {
+	// Binary output needn't hold a newline, yet still streams.
+	data := strings.Repeat("x", 5*readBufSize) + "\nend"
+	lr := newTestLineReader(strings.NewReader(data))
+	lr.binary.Store(true)
+	var raw []byte
+	for c := lr.next(); c != nil; c = lr.next() {
+		assert.LessOrEqual(t, len(c.Raw(0)), readBufSize)
+		assert.Empty(t, c.Partial())
+		raw = append(raw, c.Raw(0)...)
+		c.Release()
+	}
+	assert.Equal(t, data, string(raw))
+	assert.Len(t, lr.buf, readBufSize)
+}
@@ -6,32 +6,56 @@ import (
 	"os"
 )
 
-// VerboseLoggingEnabled can be set true to see detailed logging.
+// VerboseLoggingEnabled can be set true to see detailed logging of
+// all Channels.  Set it before starting any; to see the logging of
+// just some, use Params.DetailedLogging.
 // nolint:gochecknoglobals
 var VerboseLoggingEnabled = false
 
-type logSink struct{}
-
 const AbbrevMaxLen = 70
 
-func abbrev(x string) string {
+// chLogger logs the workings of one set of Channels,
+// hiding the secrets of their Redactor.
+type chLogger struct {
+	*log.Logger
+	sink *logSink
+}
+
+func newLogger(p *Params) *chLogger {
+	sink := &logSink{detailed: p.DetailedLogging, r: p.Redactor}
+	return &chLogger{
+		Logger: log.New(sink, "CHNLR: ", log.Ldate|log.Ltime|log.Lshortfile),
+		sink:   sink,
+	}
+}
+
+// enabled is true if logging is.
+func (l *chLogger) enabled() bool {
+	return VerboseLoggingEnabled || l.sink.detailed
+}
+
+// abbrev redacts, then abbreviates, the string.
+func (l *chLogger) abbrev(x string) string {
+	x = l.sink.r.Redact(x)
 	if len(x) > AbbrevMaxLen {
 		return x[0:AbbrevMaxLen-1] + "..."
 	}
 	return x
 }
 
-func (l logSink) Write(p []byte) (n int, err error) {
-	if VerboseLoggingEnabled {
+type logSink struct {
+	detailed bool
+	r        *Redactor
+}
+
+func (l *logSink) Write(p []byte) (n int, err error) {
+	if VerboseLoggingEnabled || l.detailed {
 		//nolint:wrapcheck
-		return fmt.Fprint(os.Stderr, string(p))
+		return fmt.Fprint(os.Stderr, l.r.Redact(string(p)))
 	}
 	return 0, nil
 }
 
-// nolint:gochecknoglobals
-var logger = log.New(&logSink{}, "CHNLR: ", log.Ldate|log.Ltime|log.Lshortfile)
-
 const errCategory = "channeler"
 
 func paramErr(format string, a ...any) error {
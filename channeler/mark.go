@@ -0,0 +1,82 @@
+package channeler
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+// markable is a stream that supports Channels.Mark.
+// Files made by os.Pipe, and network connections, are markable.
+type markable interface {
+	SetReadDeadline(time.Time) error
+	SyscallConn() (syscall.RawConn, error)
+}
+
+// enableMarks prepares the lineReader to place boundaries.
+func (lr *lineReader) enableMarks() error {
+	m, ok := lr.rd.(markable)
+	if !ok {
+		return paramErr("%s stream doesn't support marks", lr.stream)
+	}
+	raw, err := m.SyscallConn()
+	if err != nil {
+		return paramErrCaused(err, "%s stream doesn't support marks", lr.stream)
+	}
+	lr.marker, lr.raw = m, raw
+	return nil
+}
+
+// mark asks for a boundary following everything now
+// waiting to be read, waking the reader if it's blocked.
+func (lr *lineReader) mark() {
+	lr.marks.Add(1)
+	_ = lr.marker.SetReadDeadline(time.Now())
+}
+
+// wasWoken is true if the error is from a read woken by mark.
+// Such a read's deadline is cleared.
+func (lr *lineReader) wasWoken(err error) bool {
+	if lr.marker == nil || !errors.Is(err, os.ErrDeadlineExceeded) {
+		return false
+	}
+	_ = lr.marker.SetReadDeadline(time.Time{})
+	return true
+}
+
+// boundary reads until nothing is waiting to be read, and returns
+// all complete lines, and any unterminated line, in a boundary Chunk.
+func (lr *lineReader) boundary() *Chunk {
+	lr.marks.Add(-1)
+	for !lr.eof {
+		lr.makeRoom()
+		n, err := readNow(lr.raw, lr.buf[lr.end:])
+		lr.end += n
+		if lr.wasWoken(err) {
+			// A mark's deadline was still set.
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				lr.err = err
+			}
+			lr.eof = true
+			break
+		}
+		if n == 0 {
+			break
+		}
+	}
+	c := lr.splitLines()
+	if c == nil {
+		c = newChunk()
+	}
+	if lr.start < lr.end {
+		c.appendRaw(lr.buf[lr.start:lr.end])
+		lr.start = lr.end
+	}
+	c.boundary = true
+	return c
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package channeler
+
+import "syscall"
+
+func readNow(syscall.RawConn, []byte) (int, error) {
+	return 0, paramErr("marks are only supported on unix")
+}
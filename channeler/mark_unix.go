@@ -0,0 +1,37 @@
+//go:build unix
+
+package channeler
+
+import (
+	"errors"
+	"io"
+	"syscall"
+)
+
+// readNow reads what's waiting to be read, without waiting for more.
+// It returns 0 and no error if nothing is waiting.
+func readNow(raw syscall.RawConn, buf []byte) (int, error) {
+	var (
+		n     int
+		errNo error
+	)
+	err := raw.Read(func(fd uintptr) bool {
+		for {
+			n, errNo = syscall.Read(int(fd), buf)
+			if !errors.Is(errNo, syscall.EINTR) {
+				return true
+			}
+		}
+	})
+	switch {
+	case err != nil:
+		return 0, err //nolint:wrapcheck
+	case errors.Is(errNo, syscall.EAGAIN):
+		return 0, nil
+	case errNo != nil:
+		return 0, errNo //nolint:wrapcheck
+	case n == 0:
+		return 0, io.EOF
+	}
+	return n, nil
+}
@@ -11,6 +11,11 @@ import (
 // It's a mix of subprocess parameters, like Path and Args,
 // and orchestration parameters like buffer sizes and timeouts.
 type Params struct {
+	// Transport, if not nil, connects to the shell, and Path, Args
+	// and WorkingDir are ignored.  Otherwise the shell is run as a
+	// subprocess by an ExecTransport made from them.
+	Transport Transport
+
 	// Path is either the absolute path to the executable, or a $PATH
 	// relative command name.  This is the shell being run.
 	Path string
@@ -22,6 +27,13 @@ type Params struct {
 	// WorkingDir is the working directory of the shell process.
 	WorkingDir string
 
+	// ControlFD, if true, gives the shell a pipe as file descriptor 3,
+	// apart from stdout and stderr, and enables Channels.Mark.  Lines
+	// the shell writes to the pipe arrive on Channels.Control.  With
+	// a Transport other than the default, the Transport's Conn must
+	// provide the pipe.
+	ControlFD bool
+
 	// CommandTerminator, if not 0, is appended to the end of every command.
 	// This is a convenience for shells like mysql that want such things.
 	// Example: ';'
@@ -42,9 +54,12 @@ type Params struct {
 	// Increasing BuffSizeIn doesn't help here.
 	ChTimeoutIn time.Duration
 
-	// BuffSizeOut is how many lines of output can be accepted
+	// BuffSizeOut is how many chunks of output can be accepted
 	// from the shell's stdout before back pressure is applied,
 	// forcing the shell to wait before its output is consumed.
+	// A chunk holds the complete lines obtained in one read of
+	// the stream, so it's at most a few tens of kilobytes unless
+	// the lines themselves are very long.
 	BuffSizeOut int
 
 	// BuffSizeErr is like BuffSizeOut, except for stderr.
@@ -59,11 +74,32 @@ type Params struct {
 	// This is an infrastructure parameter. It's not meant
 	// for use by a client.
 	InfraConsumerTimeout time.Duration
+
+	// SpillQuota, if positive, enables spilling.  When the consumer of
+	// stdOut or stdErr falls InfraConsumerTimeout behind, the stream's
+	// further output goes to a temporary file instead, and is fed to
+	// the consumer, in order, as it catches up.  SpillQuota is the most
+	// bytes a stream may hold on disk; exhausting it results in an error
+	// on the Done channel, just like an expired InfraConsumerTimeout
+	// does when spilling is disabled.
+	SpillQuota int64
+
+	// SpillDir is the directory holding spill files.
+	// If empty, os.TempDir is used.
+	SpillDir string
+
+	// Redactor, if not nil, hides its secrets from the logs and errors
+	// of the Channels.
+	Redactor *Redactor
+
+	// DetailedLogging, if true, logs the workings of the Channels,
+	// as VerboseLoggingEnabled does for all.
+	DetailedLogging bool
 }
 
 const (
 	defaultBuffSizeIn  = 100
-	defaultBuffSizeOut = 10000
+	defaultBuffSizeOut = 256
 	defaultBuffSizeErr = 100
 
 	// make this value interesting so that it's easy to spot.
@@ -77,12 +113,27 @@ const (
 
 func (p *Params) Validate() error {
 	p.setDefaults()
+	if err := p.validateSpillDir(); err != nil {
+		return err
+	}
+	if p.Transport != nil {
+		return nil
+	}
 	if err := p.validateWorkDir(); err != nil {
 		return err
 	}
 	return p.validatePath()
 }
 
+// transport returns the Transport to use.
+func (p *Params) transport() Transport {
+	if p.Transport != nil {
+		return p.Transport
+	}
+	return &ExecTransport{
+		Path: p.Path, Args: p.Args, Dir: p.WorkingDir, Control: p.ControlFD}
+}
+
 func (p *Params) setDefaults() {
 	if p.BuffSizeIn < 1 {
 		p.BuffSizeIn = defaultBuffSizeIn
@@ -101,6 +152,15 @@ func (p *Params) setDefaults() {
 	}
 }
 
+// makeSpool returns a spool for the named stream,
+// or nil if spilling is disabled.
+func (p *Params) makeSpool(name string) *spool {
+	if p.SpillQuota < 1 {
+		return nil
+	}
+	return newSpool(name, p.SpillDir, p.SpillQuota)
+}
+
 func (p *Params) validateWorkDir() (err error) {
 	p.WorkingDir, err = filepath.Abs(p.WorkingDir)
 	if err != nil {
@@ -117,6 +177,20 @@ func (p *Params) validateWorkDir() (err error) {
 	return nil
 }
 
+func (p *Params) validateSpillDir() error {
+	if p.SpillQuota < 1 || p.SpillDir == "" {
+		return nil
+	}
+	info, err := os.Stat(p.SpillDir)
+	if err != nil {
+		return paramErrCaused(err, "bad spill dir stat")
+	}
+	if !info.IsDir() {
+		return paramErr("spill dir %q is not a directory", p.SpillDir)
+	}
+	return nil
+}
+
 func (p *Params) validatePath() (err error) {
 	if p.Path == "" {
 		return paramErr("must specify Path to the executable to run")
@@ -0,0 +1,145 @@
+package channeler
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces a secret.
+const Redacted = "[REDACTED]"
+
+// Redactor hides secrets, e.g. passwords sent to a shell, replacing
+// them with Redacted.  It's safe for concurrent use, and secrets may
+// be added at any time, e.g. once a token has been read from output.
+//
+// The secrets of the Redactor given in Params are hidden from the log
+// lines and error messages made for those Params' Channels, and, by
+// shexec, for the Shell using them.  Output passed to parsers isn't
+// redacted.
+type Redactor struct {
+	mu       sync.RWMutex
+	values   []string
+	patterns []*regexp.Regexp
+	// included counts the inclusions of other Redactors.
+	included map[*Redactor]int
+}
+
+// AddValue adds a secret value.  An empty value is ignored.
+func (r *Redactor) AddValue(v string) {
+	if v == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if slices.Contains(r.values, v) {
+		return
+	}
+	r.values = append(r.values, v)
+	// Longer values first, so that a value holding another is
+	// hidden whole.
+	slices.SortStableFunc(r.values, func(a, b string) int {
+		return len(b) - len(a)
+	})
+}
+
+// AddPattern adds a pattern matching secrets.
+func (r *Redactor) AddPattern(re *regexp.Regexp) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.patterns = append(r.patterns, re)
+}
+
+// Redact returns s with the Redactor's secrets hidden.
+// A nil Redactor hides nothing.
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, v := range r.values {
+		s = strings.ReplaceAll(s, v, Redacted)
+	}
+	for _, re := range r.patterns {
+		s = re.ReplaceAllLiteralString(s, Redacted)
+	}
+	for o := range r.included {
+		s = o.Redact(s)
+	}
+	return s
+}
+
+// Include adds the other Redactor's secrets, those it has and those
+// it gets, to this one's, until the returned function is called.
+// A Redactor may be included more than once at a time, but not, even
+// indirectly, in itself.  Including a nil Redactor does nothing.
+func (r *Redactor) Include(other *Redactor) (exclude func()) {
+	if other == nil {
+		return func() {}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.included == nil {
+		r.included = make(map[*Redactor]int)
+	}
+	r.included[other]++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if r.included[other]--; r.included[other] == 0 {
+				delete(r.included, other)
+			}
+		})
+	}
+}
+
+// RedactError returns err, or if its message holds the Redactor's
+// secrets, an error with them hidden.  Unwrapping that error yields
+// the errors err wraps, likewise redacted, so errors.As finds those
+// holding no secrets; errors.Is matches whatever err matches.
+func (r *Redactor) RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	hidden := r.Redact(msg)
+	if hidden == msg {
+		return err
+	}
+	e := &redactedError{msg: hidden, err: err}
+	// The chain is redacted now, as secrets may later be forgotten.
+	switch x := err.(type) {
+	case interface{ Unwrap() error }:
+		if inner := x.Unwrap(); inner != nil {
+			e.wrapped = []error{r.RedactError(inner)}
+		}
+	case interface{ Unwrap() []error }:
+		for _, inner := range x.Unwrap() {
+			if inner != nil {
+				e.wrapped = append(e.wrapped, r.RedactError(inner))
+			}
+		}
+	}
+	return e
+}
+
+// redactedError hides secrets in the message of the error it
+// replaces, and in those of the errors that error wraps.
+type redactedError struct {
+	msg string
+	// err is the original, only consulted by Is.
+	err     error
+	wrapped []error
+}
+
+func (e *redactedError) Error() string   { return e.msg }
+func (e *redactedError) Unwrap() []error { return e.wrapped }
+
+func (e *redactedError) Is(target error) bool {
+	return errors.Is(e.err, target)
+}
@@ -0,0 +1,110 @@
+package channeler_test
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+
+	. "github.com/monopole/shexec/channeler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactor(t *testing.T) {
+	var r *Redactor
+	assert.Equal(t, "pw", r.Redact("pw"))
+
+	r = &Redactor{}
+	r.AddValue("")
+	r.AddValue("open")
+	r.AddValue("open sesame")
+	r.AddValue("open")
+	r.AddPattern(regexp.MustCompile(`token=\w+`))
+	assert.Equal(t,
+		"say [REDACTED] or [REDACTED]; [REDACTED] ok",
+		r.Redact("say open sesame or open; token=a1b2 ok"))
+}
+
+func TestInclude(t *testing.T) {
+	const secret = "hunter2_d41d8cd9"
+	r, other := &Redactor{}, &Redactor{}
+	assert.Equal(t, secret, r.Redact(secret))
+
+	exclude1 := r.Include(other)
+	exclude2 := r.Include(other)
+	// Secrets added later are hidden, too.
+	other.AddValue(secret)
+	assert.Equal(t, Redacted, r.Redact(secret))
+	exclude1()
+	exclude1()
+	assert.Equal(t, Redacted, r.Redact(secret))
+
+	errBase := errors.New("base")
+	err := r.RedactError(fmt.Errorf("login %s; %w", secret, errBase))
+	assert.Equal(t, "login [REDACTED]; base", err.Error())
+	assert.ErrorIs(t, err, errBase)
+	assert.Same(t, errBase, r.RedactError(errBase))
+	assert.NoError(t, r.RedactError(nil))
+	assert.Same(t, errBase, (*Redactor)(nil).RedactError(errBase))
+
+	exclude2()
+	assert.Equal(t, secret, r.Redact(secret))
+	exclude := r.Include(nil)
+	exclude()
+}
+
+func TestStartRedactsErrors(t *testing.T) {
+	const secret = "hunter2_0cc175b9"
+	r := &Redactor{}
+	r.AddValue(secret)
+	_, err := Start(&Params{Path: "/nonexistent/" + secret, Redactor: r})
+	if assert.Error(t, err) {
+		assert.NotContains(t, err.Error(), secret)
+		assert.Contains(t, err.Error(), Redacted)
+	}
+	// Other Channels aren't affected.
+	_, err = Start(&Params{Path: "/nonexistent/" + secret})
+	assert.ErrorContains(t, err, secret)
+}
+
+type secretError struct{ secret string }
+
+func (e *secretError) Error() string { return "bad " + e.secret }
+
+func TestRedactError(t *testing.T) {
+	const secret = "hunter2_92eb5ffe"
+	r := &Redactor{}
+	r.AddValue(secret)
+	assert.NoError(t, r.RedactError(nil))
+	clean := errors.New("clean")
+	assert.Same(t, clean, r.RedactError(clean))
+
+	sentinel := errors.New("sentinel " + secret)
+	inner := &secretError{secret: secret}
+	err := r.RedactError(fmt.Errorf("outer %s; %w",
+		secret, errors.Join(inner, sentinel, clean)))
+	assert.EqualError(t, err,
+		"outer [REDACTED]; bad [REDACTED]\nsentinel [REDACTED]\nclean")
+
+	// No unwrapped error tells the secret.
+	var walk func(error)
+	walk = func(e error) {
+		assert.NotContains(t, e.Error(), secret)
+		switch x := e.(type) {
+		case interface{ Unwrap() error }:
+			walk(x.Unwrap())
+		case interface{ Unwrap() []error }:
+			for _, e := range x.Unwrap() {
+				walk(e)
+			}
+		}
+	}
+	walk(err)
+
+	// Identities survive, but only errors without secrets are found.
+	assert.ErrorIs(t, err, sentinel)
+	assert.ErrorIs(t, err, inner)
+	assert.ErrorIs(t, err, clean)
+	var se *secretError
+	assert.False(t, errors.As(err, &se))
+}
@@ -0,0 +1,322 @@
+package channeler
+
+import (
+	"encoding/binary"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// spillHeaderLen is the size of each length field in a spill file.
+	spillHeaderLen = 4
+	// spillMetaLen is the size of a record's Chunk metadata.
+	spillMetaLen = 4 + 4 + 8 + 8
+
+	// spillBoundary is the flag bit recording Chunk.Boundary.
+	spillBoundary = 1
+)
+
+// spool holds output that a stream's consumer hasn't kept up with,
+// in a temporary file, and feeds it to the consumer in order as
+// the consumer catches up.
+//
+// A spill file is a sequence of records, one per Chunk:
+//
+//	recordLen, stream, flags, time, firstSeq, lineCount,
+//	(lineLen, lineBytes)..., partialLen, partialBytes
+//
+// with time (in Unix nanoseconds) and firstSeq as big-endian uint64,
+// and everything else as big-endian uint32.
+type spool struct {
+	name  string
+	dir   string
+	quota int64
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	file *os.File
+	// wOff and rOff are the write and read offsets in file.
+	// The file is truncated whenever the reader catches up.
+	wOff, rOff int64
+	// inFlight is true while a Chunk taken from the file
+	// is being handed to the consumer.
+	inFlight bool
+	// finished is true once the stream has no more output.
+	finished bool
+	// aborted is true if the spool should be abandoned.
+	aborted bool
+	feeding bool
+	wBuf    []byte
+	rBuf    []byte
+
+	// chFinished closes when finished or aborted becomes true.
+	chFinished chan struct{}
+	// chFed closes when the feeder thread exits.
+	chFed chan struct{}
+}
+
+func newSpool(name, dir string, quota int64) *spool {
+	sp := &spool{
+		name:       name,
+		dir:        dir,
+		quota:      quota,
+		chFinished: make(chan struct{}),
+		chFed:      make(chan struct{}),
+	}
+	sp.cond = sync.NewCond(&sp.mu)
+	return sp
+}
+
+// busy is true if the spool holds output not yet consumed.
+// While busy, new output must go to the spool to preserve order.
+func (sp *spool) busy() bool {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return sp.wOff > sp.rOff || sp.inFlight
+}
+
+// put appends the Chunk to the spill file, and releases it.
+// It returns an error if doing so would exceed the quota.
+func (sp *spool) put(c *Chunk) error {
+	defer c.Release()
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.file == nil {
+		f, err := os.CreateTemp(sp.dir, "shexec-spill-"+sp.name+"-*")
+		if err != nil {
+			return paramErrCaused(err, "unable to create spill file")
+		}
+		sp.file = f
+	}
+	sp.wBuf = encodeChunk(sp.wBuf[:0], c)
+	if sp.wOff+int64(len(sp.wBuf)) > sp.quota {
+		return paramErr(
+			"spill quota of %d bytes exhausted on chan %s", sp.quota, sp.name)
+	}
+	if _, err := sp.file.WriteAt(sp.wBuf, sp.wOff); err != nil {
+		return paramErrCaused(err, "unable to write spill file")
+	}
+	sp.wOff += int64(len(sp.wBuf))
+	sp.cond.Signal()
+	return nil
+}
+
+// take blocks until a Chunk can be read from the spill file,
+// returning nil if the stream has finished and the file is drained,
+// or if the spool was aborted.
+func (sp *spool) take() (*Chunk, error) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	for sp.wOff == sp.rOff && !sp.finished && !sp.aborted {
+		sp.cond.Wait()
+	}
+	if sp.aborted || sp.wOff == sp.rOff {
+		return nil, nil
+	}
+	c, n, err := sp.readRecord()
+	if err != nil {
+		return nil, err
+	}
+	sp.rOff += n
+	if sp.rOff == sp.wOff {
+		sp.rOff, sp.wOff = 0, 0
+		if err = sp.file.Truncate(0); err != nil {
+			c.Release()
+			return nil, paramErrCaused(err, "unable to truncate spill file")
+		}
+	}
+	sp.inFlight = true
+	return c, nil
+}
+
+func (sp *spool) readRecord() (*Chunk, int64, error) {
+	var header [spillHeaderLen]byte
+	if _, err := sp.file.ReadAt(header[:], sp.rOff); err != nil {
+		return nil, 0, paramErrCaused(err, "unable to read spill file")
+	}
+	n := int(binary.BigEndian.Uint32(header[:]))
+	if cap(sp.rBuf) < n {
+		sp.rBuf = make([]byte, n)
+	}
+	sp.rBuf = sp.rBuf[:n]
+	if _, err := sp.file.ReadAt(sp.rBuf, sp.rOff+spillHeaderLen); err != nil {
+		return nil, 0, paramErrCaused(err, "unable to read spill file")
+	}
+	c, err := decodeChunk(sp.rBuf)
+	if err != nil {
+		return nil, 0, err
+	}
+	return c, int64(spillHeaderLen + n), nil
+}
+
+func (sp *spool) isAborted() bool {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return sp.aborted
+}
+
+// handedOff notes that a taken Chunk reached the consumer.
+func (sp *spool) handedOff() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.inFlight = false
+}
+
+// finish notes that the stream has ended, and waits for the
+// feeder to drain the spill file.
+func (sp *spool) finish() {
+	sp.stop(func() { sp.finished = true })
+}
+
+// abort stops the feeder without draining the spill file.
+func (sp *spool) abort() {
+	sp.stop(func() { sp.aborted = true })
+}
+
+func (sp *spool) stop(mark func()) {
+	sp.mu.Lock()
+	mark()
+	sp.cond.Broadcast()
+	if !sp.feeding {
+		// No feeder to wait on.
+		sp.feeding = true
+		close(sp.chFed)
+	}
+	select {
+	case <-sp.chFinished:
+	default:
+		close(sp.chFinished)
+	}
+	sp.mu.Unlock()
+	<-sp.chFed
+	if sp.file != nil {
+		_ = sp.file.Close()
+		_ = os.Remove(sp.file.Name())
+	}
+}
+
+// startFeeding starts, if not already started, a thread that moves
+// spilled Chunks to the channel.  While the stream is live, the feeder
+// waits as long as it takes for the consumer.  Once the stream has
+// finished, each send must complete within consumerTimeout, as
+// it would without spilling.
+func (sp *spool) startFeeding(
+	chStream chan<- *Chunk, chDone chan<- error, consumerTimeout time.Duration,
+) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.feeding {
+		return
+	}
+	sp.feeding = true
+	go func() {
+		defer close(sp.chFed)
+		for {
+			c, err := sp.take()
+			if err != nil {
+				chDone <- err
+				return
+			}
+			if c == nil {
+				return
+			}
+			if err = sp.feed(chStream, c, consumerTimeout); err != nil {
+				chDone <- err
+				return
+			}
+			sp.handedOff()
+		}
+	}()
+}
+
+func (sp *spool) feed(
+	chStream chan<- *Chunk, c *Chunk, consumerTimeout time.Duration) error {
+	select {
+	case chStream <- c:
+		return nil
+	case <-sp.chFinished:
+	}
+	if sp.isAborted() {
+		c.Release()
+		return nil
+	}
+	select {
+	case chStream <- c:
+		return nil
+	case <-time.After(consumerTimeout):
+		c.Release()
+		return paramErr(
+			"consumerTimeout=%s elapsed awaiting consumer on chan %s",
+			consumerTimeout, sp.name)
+	}
+}
+
+func encodeChunk(buf []byte, c *Chunk) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, 0) // placeholder
+	buf = binary.BigEndian.AppendUint32(buf, uint32(c.stream))
+	var flags uint32
+	if c.boundary {
+		flags |= spillBoundary
+	}
+	buf = binary.BigEndian.AppendUint32(buf, flags)
+	var nanos int64
+	if !c.time.IsZero() {
+		nanos = c.time.UnixNano()
+	}
+	buf = binary.BigEndian.AppendUint64(buf, uint64(nanos))
+	buf = binary.BigEndian.AppendUint64(buf, c.firstSeq)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(c.Len()))
+	for i := 0; i < c.Len(); i++ {
+		line := c.rawLine(i)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(line)))
+		buf = append(buf, line...)
+	}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(c.partial)))
+	buf = append(buf, c.partial...)
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-spillHeaderLen))
+	return buf
+}
+
+func decodeChunk(rec []byte) (*Chunk, error) {
+	bad := func() error { return paramErr("corrupt spill record") }
+	if len(rec) < spillMetaLen+spillHeaderLen {
+		return nil, bad()
+	}
+	c := newChunk()
+	c.stream = Stream(binary.BigEndian.Uint32(rec))
+	c.boundary = binary.BigEndian.Uint32(rec[4:])&spillBoundary != 0
+	if nanos := int64(binary.BigEndian.Uint64(rec[8:])); nanos != 0 {
+		c.time = time.Unix(0, nanos)
+	}
+	c.firstSeq = binary.BigEndian.Uint64(rec[16:])
+	rec = rec[spillMetaLen:]
+	count := int(binary.BigEndian.Uint32(rec))
+	rec = rec[spillHeaderLen:]
+	for i := 0; i < count; i++ {
+		if len(rec) < spillHeaderLen {
+			c.Release()
+			return nil, bad()
+		}
+		n := int(binary.BigEndian.Uint32(rec))
+		rec = rec[spillHeaderLen:]
+		if len(rec) < n {
+			c.Release()
+			return nil, bad()
+		}
+		c.appendRaw(rec[:n])
+		rec = rec[n:]
+	}
+	if len(rec) < spillHeaderLen {
+		c.Release()
+		return nil, bad()
+	}
+	n := int(binary.BigEndian.Uint32(rec))
+	rec = rec[spillHeaderLen:]
+	if len(rec) < n {
+		c.Release()
+		return nil, bad()
+	}
+	c.partial = append(c.partial, rec[:n]...)
+	return c, nil
+}
@@ -5,61 +5,71 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os/exec"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// Start starts a shell subprocess, and returns an instance of Channels.
+// Start starts a shell, and returns an instance of Channels.
+// The shell is a subprocess, unless Params has some other Transport.
 // The holder of this instance can send input on the StdIn channel, process
 // output from StdOut and StdErr channels, and look for an error on the
 // Done channel. To stop the subprocess gracefully, close the StdIn channel.
 // The point of this infrastructure is to set up timeouts to assure
 // that things terminate and that channels close, freeing the client to just
 // focus on these four channels.
+// Logging and errors hide the secrets of Params.Redactor.
 func Start(p *Params) (*Channels, error) {
-	var (
-		err              error
-		stdIn            io.WriteCloser
-		scanOut, scanErr *bufio.Scanner
-	)
-	if err = p.Validate(); err != nil {
-		return nil, err
+	chs, err := start(p)
+	if err != nil {
+		return nil, p.Redactor.RedactError(err)
 	}
-	cmd := exec.Command(p.Path, p.Args...)
-	cmd.Dir = p.WorkingDir
+	return chs, nil
+}
 
-	stdIn, err = cmd.StdinPipe()
+func start(p *Params) (*Channels, error) {
+	// seq numbers lines across both output streams.
+	var seq atomic.Uint64
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	logger := newLogger(p)
+	conn, err := p.transport().Connect()
 	if err != nil {
-		return nil, fmt.Errorf("getting stdIn for %q; %w", p.Path, err)
+		return nil, err
 	}
-
-	{
-		var pipe io.ReadCloser
-
-		pipe, err = cmd.StdoutPipe()
-		if err != nil {
-			return nil, fmt.Errorf("getting stdOut for %q; %w", p.Path, err)
-		}
-		scanOut = bufio.NewScanner(pipe)
-
-		pipe, err = cmd.StderrPipe()
-		if err != nil {
-			return nil, fmt.Errorf("getting stdErr for %q; %w", p.Path, err)
-		}
-		scanErr = bufio.NewScanner(pipe)
-
-		if err = cmd.Start(); err != nil {
-			return nil, fmt.Errorf("trying to start %s - %w", p.Path, err)
+	stdIn := conn.StdIn
+	scanOut := newLineReader(conn.StdOut, StreamOut, &seq)
+	stdErr := conn.StdErr
+	if stdErr == nil {
+		stdErr = noStream()
+	}
+	scanErr := newLineReader(stdErr, StreamErr, &seq)
+	wait := conn.Wait
+	if wait == nil {
+		wait = func() error { return nil }
+	}
+	var (
+		chControl <-chan string
+		mark      func()
+	)
+	if p.ControlFD {
+		if chControl, mark, err = startControl(
+			conn, scanOut, scanErr, logger); err != nil {
+			_ = stdIn.Close()
+			_ = wait()
+			return nil, err
 		}
 	}
 
 	// Make all the communication channels.
 	chStdIn := make(chan string, p.BuffSizeIn)
-	chStdOut := make(chan string, p.BuffSizeOut)
-	chStdErr := make(chan string, p.BuffSizeErr)
+	chStdOut := make(chan *Chunk, p.BuffSizeOut)
+	chStdErr := make(chan *Chunk, p.BuffSizeErr)
 	chDone := make(chan error)
+	chFeed := make(chan feed)
+	chInputDone := make(chan struct{})
 
 	// scanWg lives as long as the process.  It's used to
 	// assure capture of the process's exit condition
@@ -75,43 +85,115 @@ func Start(p *Params) (*Channels, error) {
 	// then this routine will send an error into
 	// chDone. The timeout countdown is reset whenever output
 	// from the given pipe is consumed by the given channel.
+	// If spilling is enabled, a backed up stream spills to disk instead.
 	scanWg.Add(1)
 	go scanStreamIntoChannel(
-		"stdOut", chStdOut, scanOut,
-		&scanWg, chDone, p.InfraConsumerTimeout)
+		"stdOut", chStdOut, scanOut, &scanWg, chDone,
+		p.InfraConsumerTimeout, p.makeSpool("stdOut"), logger)
 	scanWg.Add(1)
 	go scanStreamIntoChannel(
-		"stdErr", chStdErr, scanErr,
-		&scanWg, chDone, p.InfraConsumerTimeout)
+		"stdErr", chStdErr, scanErr, &scanWg, chDone,
+		p.InfraConsumerTimeout, p.makeSpool("stdErr"), logger)
 
 	// Start the input thread.  It runs until chStdIn is closed.
-	go writeInputToSubprocess(
-		chStdIn, stdIn, scanOut, scanErr, p.CommandTerminator,
-		&scanWg, chDone, p.ChTimeoutIn, cmd.Wait)
+	go func() {
+		defer close(chInputDone)
+		writeInputToSubprocess(
+			chStdIn, chFeed, stdIn, scanOut, scanErr, p.CommandTerminator,
+			&scanWg, chDone, p.ChTimeoutIn, wait, logger)
+	}()
 
 	return &Channels{
 		StdIn:  chStdIn,
 		StdOut: chStdOut,
 		StdErr: chStdErr,
 		Done:   chDone,
+		Feed: func(rd io.Reader) error {
+			f := feed{rd: rd, chErr: make(chan error, 1)}
+			select {
+			case chFeed <- f:
+				return <-f.chErr
+			case <-chInputDone:
+				return paramErr("feed failure; stdIn is closed")
+			}
+		},
+		Control: chControl,
+		Mark:    mark,
+		Binary: func(on bool) {
+			scanOut.binary.Store(on)
+			scanErr.binary.Store(on)
+		},
+		Interrupt: conn.Interrupt,
+	}, nil
+}
+
+// startControl starts forwarding lines from the control pipe,
+// and returns the Control channel and Mark function.
+func startControl(conn *Conn, scanOut, scanErr *lineReader,
+	logger *chLogger) (<-chan string, func(), error) {
+	if conn.Control == nil {
+		return nil, nil, paramErr("transport lacks a control pipe")
+	}
+	for _, lr := range []*lineReader{scanOut, scanErr} {
+		if err := lr.enableMarks(); err != nil {
+			return nil, nil, err
+		}
+	}
+	ch := make(chan string, defaultBuffSizeIn)
+	go func() {
+		defer close(ch)
+		sc := bufio.NewScanner(conn.Control)
+		for sc.Scan() {
+			logger.Printf("control; got %q", sc.Text())
+			ch <- sc.Text()
+		}
+		logger.Printf("control; pipe done; %v", sc.Err())
+	}()
+	return ch, func() {
+		scanOut.mark()
+		scanErr.mark()
 	}, nil
 }
 
-// writeInputToSubprocess forwards commands from the stdIn channel to the
-// subprocess, and closes all inputs when the subprocess fails.
+// feed is a request to copy data to the subprocess' stdIn.
+type feed struct {
+	rd io.Reader
+	// chErr gets the outcome of the copy.
+	chErr chan error
+}
+
+// trackingWriter remembers its writer's first error.
+type trackingWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (tw *trackingWriter) Write(data []byte) (int, error) {
+	n, err := tw.w.Write(data)
+	if err != nil && tw.err == nil {
+		tw.err = err
+	}
+	return n, err //nolint:wrapcheck
+}
+
+// writeInputToSubprocess forwards commands from the stdIn channel,
+// and data from the feed channel, to the subprocess, and closes all
+// inputs when the subprocess fails.
 // Regrettably it has a high cognitive complexity score.
 //
 //nolint:gocognit
 func writeInputToSubprocess(
 	chStdIn <-chan string,
+	chFeed <-chan feed,
 	stdIn io.WriteCloser,
-	scanOut *bufio.Scanner,
-	scanErr *bufio.Scanner,
+	scanOut *lineReader,
+	scanErr *lineReader,
 	terminator byte,
 	scanWg *sync.WaitGroup,
 	chDone chan<- error,
 	timeout time.Duration,
 	cmdWait func() error,
+	logger *chLogger,
 ) {
 	const name = " stdIn"
 	defer close(chDone)
@@ -132,7 +214,7 @@ func writeInputToSubprocess(
 				bytes := assureTermination(line, terminator)
 				logger.Printf(
 					"%s; got command %q, sending to subprocess",
-					name, abbrev(string(bytes)))
+					name, logger.abbrev(string(bytes)))
 				if _, err := stdIn.Write(bytes); err != nil {
 					logger.Printf(
 						"%s; unable to write stdIn; %s", name, err.Error())
@@ -144,6 +226,39 @@ func writeInputToSubprocess(
 					"%s; someone closed stdIn, shutting down.", name)
 				chStdIn = nil
 			}
+		case f := <-chFeed:
+			// Commands sent before the feed go first.
+			for pending := true; pending && moreInputComing; {
+				select {
+				case line, moreInputComing = <-chStdIn:
+					if moreInputComing {
+						_, err := stdIn.Write(
+							assureTermination(line, terminator))
+						if err != nil {
+							f.chErr <- err
+							chDone <- fmt.Errorf(
+								"unable to write to stdIn; %w", err)
+							return
+						}
+					}
+				default:
+					pending = false
+				}
+			}
+			logger.Printf("%s; feeding data to subprocess", name)
+			w := &trackingWriter{w: stdIn}
+			n, err := io.Copy(w, f.rd)
+			logger.Printf("%s; fed %d bytes to subprocess", name, n)
+			if err != nil {
+				f.chErr <- fmt.Errorf("feeding stdIn; %w", err)
+				if w.err != nil {
+					// The pipe failed, not the reader.
+					chDone <- fmt.Errorf("unable to write to stdIn; %w", err)
+					return
+				}
+				continue
+			}
+			f.chErr <- nil
 		case <-timer.C:
 			logger.Printf("%s; timeout of %s elapsed", name, timeout)
 			logger.Printf(
@@ -169,7 +284,7 @@ func writeInputToSubprocess(
 	accumError(scanOut.Err(), &buff)
 	accumError(scanErr.Err(), &buff)
 	if buff.Len() > 0 {
-		chDone <- errors.New(buff.String())
+		chDone <- logger.sink.r.RedactError(errors.New(buff.String()))
 	}
 }
 
@@ -190,56 +305,90 @@ func accumError(err error, bld *strings.Builder) {
 }
 
 // scanStreamIntoChannel reads lines from a stream, and writes them
-// to a channel, alerting on backpressure from the channel.
+// in Chunks to a channel, alerting on backpressure from the channel.
 // When finished, it closes the channel, and calls done on the waitGroup.
 // It will send a signal on chDone only if it has trouble writing
 // into the channel.
+// If sp is not nil, backpressure is relieved by spilling output to
+// disk, and a signal is sent on chDone only if the spill quota is
+// exhausted.
+//
+//nolint:gocognit
 func scanStreamIntoChannel(
 	name string,
-	chStream chan<- string,
-	scanner *bufio.Scanner,
+	chStream chan<- *Chunk,
+	scanner *lineReader,
 	wg *sync.WaitGroup,
 	chDone chan<- error,
 	consumerTimeout time.Duration,
+	sp *spool,
+	logger *chLogger,
 ) {
+	finishSpool := func() {}
+	if sp != nil {
+		finishSpool = sp.finish
+	}
 	defer func() {
+		finishSpool()
 		close(chStream)
 		wg.Done()
 	}()
 	logger.Printf("%s; awaiting data from subprocess...", name)
 	count := 0
 	timer := time.NewTimer(consumerTimeout)
-	for scanner.Scan() {
-		line := scanner.Text()
-		count++
-		logger.Printf("%s; just read line #%d: %q", name, count, abbrev(line))
+	for chunk := scanner.next(); chunk != nil; chunk = scanner.next() {
+		count += chunk.Len()
+		if logger.enabled() && chunk.Len() > 0 {
+			logger.Printf(
+				"%s; just read %d lines, up to line #%d: %q", name, chunk.Len(),
+				count, logger.abbrev(string(chunk.Line(chunk.Len()-1))))
+		}
+		if sp != nil && sp.busy() {
+			// Keep spilling until the consumer catches up,
+			// so that output stays in order.
+			if err := sp.put(chunk); err != nil {
+				finishSpool = sp.abort
+				chDone <- err
+				return
+			}
+			continue
+		}
 		if !timer.Stop() {
 			<-timer.C
 		}
 		timer.Reset(consumerTimeout)
-		logger.Printf("%s; normal backpressure timer reset", name)
 		select {
-		case chStream <- line:
-			logger.Printf("%s; forwarded %q to infra", name, abbrev(line))
+		case chStream <- chunk:
 			// Yay, the infrastructure processing the subprocess' output
 			// is alive and reading this channel.
 		case <-timer.C:
 			// Subprocess output isn't being consumed fast enough.
+			logger.Printf(
+				"%s; backpressure consumerTimeout=%s elapsed after line %d",
+				name, consumerTimeout, count)
+			if sp != nil {
+				logger.Printf("%s; spilling output to disk", name)
+				if err := sp.put(chunk); err != nil {
+					finishSpool = sp.abort
+					chDone <- err
+					return
+				}
+				sp.startFeeding(chStream, chDone, consumerTimeout)
+				// Rearm the timer, since the loop expects it running.
+				timer.Reset(consumerTimeout)
+				continue
+			}
 			// Something should drain chStream, even if only to discard
-			// the strings to /dev/null.
+			// the chunks to /dev/null.
 			// If the stream channel's buffer fills up, this loop
-			// over Scan() won't finish, which means that the call to
+			// over next() won't finish, which means that the call to
 			// cmd.Wait() above will block. This is the exit hatch to
 			// that particular deadlock.
-			logger.Printf(
-				"%s; backpressure consumerTimeout=%s elapsed after line %d",
-				name, consumerTimeout, count)
 			chDone <- paramErr(
 				"consumerTimeout=%s elapsed awaiting consumer on chan %s",
 				consumerTimeout, name)
 			return
 		}
-		logger.Printf("%s; awaiting data from subprocess...", name)
 	}
 	logger.Printf("%s; stream has closed; consumed %d lines", name, count)
 }
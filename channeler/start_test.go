@@ -1,8 +1,11 @@
 package channeler_test
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	. "github.com/monopole/shexec/channeler"
@@ -11,9 +14,12 @@ import (
 
 const theShell = "/bin/sh"
 
-func consumeChannel(name string, ch <-chan string) {
-	for line := range ch {
-		fmt.Printf("%s: %q\n", name, line)
+func consumeChannel(name string, ch <-chan *Chunk) {
+	for chunk := range ch {
+		for i := 0; i < chunk.Len(); i++ {
+			fmt.Printf("%s: %q\n", name, chunk.Line(i))
+		}
+		chunk.Release()
 	}
 }
 
@@ -31,6 +37,37 @@ func TestStartHappy(t *testing.T) {
 	assert.NoError(t, <-chs.Done)
 }
 
+func TestStartFeed(t *testing.T) {
+	chs, err := Start(&Params{
+		Path: theShell,
+	})
+	assert.NoError(t, err)
+	go consumeChannel("err", chs.StdErr)
+	var lines []string
+	chOut := make(chan struct{})
+	go func() {
+		defer close(chOut)
+		for chunk := range chs.StdOut {
+			for i := 0; i < chunk.Len(); i++ {
+				lines = append(lines, string(chunk.Line(i)))
+			}
+			chunk.Release()
+		}
+	}()
+	chs.StdIn <- "echo before"
+	chs.StdIn <- "cat <<'EOF'"
+	big := strings.Repeat("x", 200*1024)
+	assert.NoError(t, chs.Feed(strings.NewReader("hi\n"+big+"\nEOF\n")))
+	oops := errors.New("oops")
+	assert.ErrorIs(t, chs.Feed(iotest.ErrReader(oops)), oops)
+	chs.StdIn <- "echo after"
+	close(chs.StdIn)
+	assert.NoError(t, <-chs.Done)
+	<-chOut
+	assert.Equal(t, []string{"before", "hi", big, "after"}, lines)
+	assert.Error(t, chs.Feed(strings.NewReader("late")))
+}
+
 func TestStartExitZero(t *testing.T) {
 	chs, err := Start(&Params{
 		Path: theShell,
@@ -89,17 +126,19 @@ func TestStartWithBackPressure(t *testing.T) {
 	}
 	chs, err := Start(p)
 	assert.NoError(t, err)
-	chs.StdIn <- "ls -las /proc/version"
-	chs.StdIn <- "ls -las /proc/version"
+	// Emit more than a few reads' worth of output, so that it
+	// arrives in more chunks than the channel can buffer.
+	chs.StdIn <- "seq 1 100000"
 	chs.StdIn <- "exit 0"
 	close(chs.StdIn)
 	go consumeChannel("err", chs.StdErr)
 	// Use a slow consumer to create backpressure.
 	go func() {
 		time.Sleep(2 * p.InfraConsumerTimeout)
-		for line := range chs.StdOut {
+		for chunk := range chs.StdOut {
 			time.Sleep(2 * p.InfraConsumerTimeout)
-			fmt.Printf("%s: %q\n", "out", line)
+			fmt.Printf("%s: %d lines\n", "out", chunk.Len())
+			chunk.Release()
 		}
 	}()
 	if err = <-chs.Done; assert.Error(t, err) {
@@ -108,3 +147,127 @@ func TestStartWithBackPressure(t *testing.T) {
 			"consumerTimeout=50ms elapsed awaiting consumer on chan stdOut")
 	}
 }
+
+func TestStartWithBackPressureSpill(t *testing.T) {
+	p := &Params{
+		Path:                 theShell,
+		BuffSizeOut:          1,
+		InfraConsumerTimeout: 50 * time.Millisecond,
+		SpillQuota:           1 << 20,
+		SpillDir:             t.TempDir(),
+	}
+	chs, err := Start(p)
+	assert.NoError(t, err)
+	// Emit output in several bursts, so that it arrives in several chunks.
+	for i := 0; i < 5; i++ {
+		chs.StdIn <- fmt.Sprintf("seq %d %d; sleep 0.02", 1000*i+1, 1000*(i+1))
+	}
+	// Outlive the consumer's stall; once the shell exits, spilled
+	// output is again subject to InfraConsumerTimeout.
+	chs.StdIn <- "sleep 0.5"
+	chs.StdIn <- "exit 0"
+	close(chs.StdIn)
+	go consumeChannel("err", chs.StdErr)
+	chLines := make(chan []string)
+	go func() {
+		// Use a slow consumer to force spilling.
+		time.Sleep(4 * p.InfraConsumerTimeout)
+		var lines []string
+		for chunk := range chs.StdOut {
+			for i := 0; i < chunk.Len(); i++ {
+				lines = append(lines, string(chunk.Line(i)))
+			}
+			chunk.Release()
+		}
+		chLines <- lines
+	}()
+	assert.NoError(t, <-chs.Done)
+	lines := <-chLines
+	if assert.Len(t, lines, 5000) {
+		for i, line := range lines {
+			assert.Equal(t, fmt.Sprintf("%d", i+1), line)
+		}
+	}
+}
+
+func TestStartSpillQuotaExhausted(t *testing.T) {
+	p := &Params{
+		Path:                 theShell,
+		BuffSizeOut:          1,
+		InfraConsumerTimeout: 50 * time.Millisecond,
+		SpillQuota:           100,
+	}
+	chs, err := Start(p)
+	assert.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		chs.StdIn <- "seq 1 1000; sleep 0.02"
+	}
+	chs.StdIn <- "exit 0"
+	close(chs.StdIn)
+	go consumeChannel("err", chs.StdErr)
+	go func() {
+		time.Sleep(4 * p.InfraConsumerTimeout)
+		for chunk := range chs.StdOut {
+			chunk.Release()
+		}
+	}()
+	if err = <-chs.Done; assert.Error(t, err) {
+		assert.Contains(
+			t, err.Error(), "spill quota of 100 bytes exhausted on chan stdOut")
+	}
+}
+
+// untilBoundary returns the lines up to and including the next
+// boundary Chunk, or false if the channel closes first.
+func untilBoundary(ch <-chan *Chunk) (lines []string, ok bool) {
+	for chunk := range ch {
+		for i := 0; i < chunk.Len(); i++ {
+			lines = append(lines, string(chunk.Line(i)))
+		}
+		b := chunk.Boundary()
+		chunk.Release()
+		if b {
+			return lines, true
+		}
+	}
+	return lines, false
+}
+
+func TestStartControlFD(t *testing.T) {
+	chs, err := Start(&Params{Path: theShell, ControlFD: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	chs.StdIn <- "printf 'no newline'; echo oops 1>&2; false"
+	chs.StdIn <- `printf 'done %d\n' $? >&3`
+	assert.Equal(t, "done 1", <-chs.Control)
+	chs.Mark()
+	out, ok := untilBoundary(chs.StdOut)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"no newline"}, out)
+	errs, ok := untilBoundary(chs.StdErr)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"oops"}, errs)
+
+	// Lots of output, much of it unread when Mark is called.
+	chs.StdIn <- "seq 100000; echo bye >&3"
+	assert.Equal(t, "bye", <-chs.Control)
+	chs.Mark()
+	out, ok = untilBoundary(chs.StdOut)
+	assert.True(t, ok)
+	if assert.Len(t, out, 100000) {
+		assert.Equal(t, "100000", out[len(out)-1])
+	}
+	errs, ok = untilBoundary(chs.StdErr)
+	assert.True(t, ok)
+	assert.Empty(t, errs)
+
+	close(chs.StdIn)
+	assert.NoError(t, <-chs.Done)
+	_, ok = <-chs.Control
+	assert.False(t, ok)
+
+	_, err = Start(&Params{
+		ControlFD: true, Transport: &PipeTransport{Serve: shout}})
+	assert.ErrorContains(t, err, "lacks a control pipe")
+}
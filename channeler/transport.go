@@ -0,0 +1,182 @@
+package channeler
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Transport connects to a shell.  The shell might be a subprocess,
+// a process started elsewhere, a REPL server across a socket, or
+// something in-process; Start treats them all alike.
+type Transport interface {
+	Connect() (*Conn, error)
+}
+
+// Conn holds the streams of a connected shell.
+type Conn struct {
+	// StdIn gets commands.  It's closed to end the session.
+	StdIn io.WriteCloser
+	// StdOut yields the shell's output.
+	StdOut io.Reader
+	// StdErr yields the shell's error output.  If nil, the shell
+	// has no error stream, and the StdErr channel has no output;
+	// don't use an error sentinel with such a shell.
+	StdErr io.Reader
+	// Wait, if not nil, is called once StdIn is closed and both
+	// output streams are exhausted.  Its error, e.g. a non-zero
+	// exit status, is sent on the Done channel.
+	Wait func() error
+	// Interrupt, if not nil, becomes Channels.Interrupt.
+	Interrupt func() error
+	// Control, if not nil, yields what the shell writes to its
+	// control pipe; see Params.ControlFD.
+	Control io.Reader
+}
+
+// TransportFunc adapts a function to a Transport.
+type TransportFunc func() (*Conn, error)
+
+func (f TransportFunc) Connect() (*Conn, error) { return f() }
+
+// ExecTransport runs a shell as a subprocess.
+// It's the Transport used if Params.Transport is nil.
+type ExecTransport struct {
+	Path string
+	Args []string
+	Dir  string
+	// Control, if true, gives the shell a control pipe
+	// as file descriptor 3.
+	Control bool
+}
+
+func (t *ExecTransport) Connect() (*Conn, error) {
+	cmd := exec.Command(t.Path, t.Args...)
+	cmd.Dir = t.Dir
+	var ctlR, ctlW *os.File
+	if t.Control {
+		var err error
+		if ctlR, ctlW, err = os.Pipe(); err != nil {
+			return nil, fmt.Errorf("making control pipe; %w", err)
+		}
+		cmd.ExtraFiles = []*os.File{ctlW}
+		defer ctlW.Close()
+	}
+	conn, err := t.start(cmd)
+	if err != nil {
+		if ctlR != nil {
+			_ = ctlR.Close()
+		}
+		return nil, err
+	}
+	if ctlR != nil {
+		conn.Control = ctlR
+		wait := conn.Wait
+		conn.Wait = func() error {
+			// Don't await EOF on the control pipe;
+			// the shell's children may hold it open.
+			defer ctlR.Close()
+			return wait()
+		}
+	}
+	return conn, nil
+}
+
+func (t *ExecTransport) start(cmd *exec.Cmd) (*Conn, error) {
+	stdIn, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("getting stdIn for %q; %w", t.Path, err)
+	}
+	stdOut, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("getting stdOut for %q; %w", t.Path, err)
+	}
+	stdErr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("getting stdErr for %q; %w", t.Path, err)
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("trying to start %s - %w", t.Path, err)
+	}
+	return &Conn{
+		StdIn:  stdIn,
+		StdOut: stdOut,
+		StdErr: stdErr,
+		Wait:   cmd.Wait,
+		Interrupt: func() error {
+			return cmd.Process.Signal(os.Interrupt)
+		},
+	}, nil
+}
+
+// PipeTransport runs a shell in-process.  On Connect, Serve is
+// called in its own goroutine, connected to the Conn by pipes.
+// It should read commands from stdIn until EOF.  Its error is
+// returned by the Conn's Wait.
+type PipeTransport struct {
+	Serve func(stdIn io.Reader, stdOut, stdErr io.Writer) error
+}
+
+func (t *PipeTransport) Connect() (*Conn, error) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	errR, errW := io.Pipe()
+	chErr := make(chan error, 1)
+	go func() {
+		err := t.Serve(inR, outW, errW)
+		// Unblock any writer, and end the output streams.
+		_ = inR.Close()
+		_ = outW.Close()
+		_ = errW.Close()
+		chErr <- err
+	}()
+	return &Conn{
+		StdIn:  inW,
+		StdOut: outR,
+		StdErr: errR,
+		Wait:   func() error { return <-chErr },
+	}, nil
+}
+
+// DialTransport connects to a shell served on a network socket, e.g.
+// a REPL listening on a unix domain socket.  The socket carries stdIn
+// and stdOut; there's no error stream.  Ending the session closes the
+// socket for writing, so the server sees EOF.
+type DialTransport struct {
+	// Network and Address are as for net.Dial,
+	// e.g. "unix" and "/tmp/repl.sock".
+	Network string
+	Address string
+}
+
+func (t *DialTransport) Connect() (*Conn, error) {
+	c, err := net.Dial(t.Network, t.Address)
+	if err != nil {
+		return nil, paramErrCaused(err, "dialing %s", t.Address)
+	}
+	return &Conn{
+		StdIn:  &halfCloser{c},
+		StdOut: c,
+		Wait:   c.Close,
+	}, nil
+}
+
+// halfCloser closes a connection for writing only, if it can.
+type halfCloser struct {
+	net.Conn
+}
+
+func (hc *halfCloser) Close() error {
+	if cw, ok := hc.Conn.(interface{ CloseWrite() error }); ok {
+		//nolint:wrapcheck
+		return cw.CloseWrite()
+	}
+	//nolint:wrapcheck
+	return hc.Conn.Close()
+}
+
+// noStream is the error stream of a shell without one.
+func noStream() io.Reader { return strings.NewReader("") }
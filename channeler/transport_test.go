@@ -0,0 +1,103 @@
+package channeler_test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/monopole/shexec/channeler"
+	"github.com/stretchr/testify/assert"
+)
+
+// collect returns all the lines from a channel, once it closes.
+func collect(ch <-chan *Chunk) <-chan []string {
+	result := make(chan []string, 1)
+	go func() {
+		var lines []string
+		for chunk := range ch {
+			for i := 0; i < chunk.Len(); i++ {
+				lines = append(lines, string(chunk.Line(i)))
+			}
+			chunk.Release()
+		}
+		result <- lines
+	}()
+	return result
+}
+
+// shout is a shell that shouts its commands back, on stdOut, and
+// complains on stdErr about commands it doesn't like.
+func shout(stdIn io.Reader, stdOut, stdErr io.Writer) error {
+	sc := bufio.NewScanner(stdIn)
+	for sc.Scan() {
+		cmd := sc.Text()
+		if cmd == "fail" {
+			return errors.New("failed")
+		}
+		if strings.HasPrefix(cmd, "bad") {
+			fmt.Fprintf(stdErr, "won't %s\n", cmd)
+			continue
+		}
+		fmt.Fprintln(stdOut, strings.ToUpper(cmd))
+	}
+	return sc.Err()
+}
+
+func TestPipeTransport(t *testing.T) {
+	chs, err := Start(&Params{Transport: &PipeTransport{Serve: shout}})
+	assert.NoError(t, err)
+	out, errs := collect(chs.StdOut), collect(chs.StdErr)
+	chs.StdIn <- "hello"
+	chs.StdIn <- "bad idea"
+	chs.StdIn <- "there"
+	close(chs.StdIn)
+	assert.NoError(t, <-chs.Done)
+	assert.Equal(t, []string{"HELLO", "THERE"}, <-out)
+	assert.Equal(t, []string{"won't bad idea"}, <-errs)
+	assert.Nil(t, chs.Interrupt)
+
+	chs, err = Start(&Params{Transport: &PipeTransport{Serve: shout}})
+	assert.NoError(t, err)
+	out, errs = collect(chs.StdOut), collect(chs.StdErr)
+	chs.StdIn <- "fail"
+	close(chs.StdIn)
+	assert.ErrorContains(t, <-chs.Done, "failed")
+	assert.Empty(t, <-out)
+	assert.Empty(t, <-errs)
+}
+
+func TestDialTransport(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "shout.sock")
+	l, err := net.Listen("unix", sock)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		_ = shout(c, c, c)
+	}()
+	chs, err := Start(&Params{
+		Transport: &DialTransport{Network: "unix", Address: sock}})
+	assert.NoError(t, err)
+	out, errs := collect(chs.StdOut), collect(chs.StdErr)
+	chs.StdIn <- "hello"
+	chs.StdIn <- "bad idea"
+	close(chs.StdIn)
+	assert.NoError(t, <-chs.Done)
+	assert.Equal(t, []string{"HELLO", "won't bad idea"}, <-out)
+	assert.Empty(t, <-errs)
+
+	_, err = Start(&Params{
+		Transport: &DialTransport{Network: "unix", Address: sock + "x"}})
+	assert.ErrorContains(t, err, "dialing")
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/monopole/shexec"
+	"github.com/monopole/shexec/mdrun"
+)
+
+type docArgs struct {
+	shell       string
+	label       string
+	outputLabel string
+	timeout     time.Duration
+	update      bool
+}
+
+// runDoc runs the command blocks in each markdown file through a
+// shell session of its own, comparing actual to expected output.
+func runDoc(argv []string) int {
+	var args docArgs
+	fs := flag.NewFlagSet("doc", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(),
+			"usage: shexec doc [flags] {file.md}...\n\n"+
+				"Runs fenced code blocks labelled %q, in order, in one shell\n"+
+				"session per file, and compares the merged stdout and stderr\n"+
+				"of each to the adjacent block labelled %q, if any.\n\n",
+			mdrun.DefaultLabel, mdrun.DefaultOutputLabel)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&args.shell, "shell", "/bin/sh",
+		"The POSIX shell that runs the command blocks.")
+	fs.StringVar(&args.label, "label", mdrun.DefaultLabel,
+		"The info string word marking a command block.")
+	fs.StringVar(&args.outputLabel, "output-label", mdrun.DefaultOutputLabel,
+		"The info string word marking an expected output block.")
+	fs.DurationVar(&args.timeout, "timeout", 10*time.Second,
+		"The longest any one command block may run.")
+	fs.BoolVar(&args.update, "update", false,
+		"Rewrite the expected output blocks to match actual output,\n"+
+			"adding one after each command block that has output but none.")
+	_ = fs.Parse(argv)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	code := 0
+	for _, path := range fs.Args() {
+		if !docFile(path, &args) {
+			code = 1
+		}
+	}
+	return code
+}
+
+// docFile handles one markdown file, returning false on any failure.
+func docFile(path string, args *docArgs) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	doc, err := mdrun.Parse(path, data, args.label, args.outputLabel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	if len(doc.Blocks) == 0 {
+		return true
+	}
+	sh := shexec.NewShell(mdrun.ShellParameters(args.shell))
+	if err = sh.Start(args.timeout); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return false
+	}
+	results := doc.Run(sh, args.timeout)
+	// Stop fails if a failed block already killed the shell.
+	_ = sh.Stop(args.timeout, "")
+	ok := true
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			ok = false
+			fmt.Fprintf(os.Stderr, "%s:%d: %v\n", path, r.Block.Line, r.Err)
+		case !r.Matches() && !args.update:
+			ok = false
+			fmt.Fprintf(os.Stderr,
+				"%s:%d: output mismatch\n--- expected\n%s\n+++ actual\n%s\n",
+				path, r.Block.Line,
+				indent(r.Block.Expected.Text), indent(r.Actual))
+		}
+	}
+	if args.update {
+		err = os.WriteFile(path, doc.Rewrite(results), fi.Mode().Perm())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return false
+		}
+	}
+	return ok
+}
+
+func indent(s string) string {
+	return "  " + strings.ReplaceAll(s, "\n", "\n  ")
+}
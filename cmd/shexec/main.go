@@ -0,0 +1,62 @@
+// The shexec command offers shexec features on the command line.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// subCommand is a shexec sub-command, e.g. "doc".
+type subCommand struct {
+	summary string
+	// run runs the sub-command with the given args, returning
+	// the process exit code.
+	run func(args []string) int
+}
+
+var subCommands = map[string]subCommand{
+	"doc": {
+		summary: "Run the command blocks in markdown files, " +
+			"checking their output.",
+		run: runDoc,
+	},
+	"run": {
+		summary: "Run YAML scenarios, checking each step's output.",
+		run:     runScenario,
+	},
+	"serve": {
+		summary: "Serve shell sessions over a local HTTP API.",
+		run:     runServe,
+	},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	sc, ok := subCommands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unrecognized command: %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(sc.run(os.Args[2:]))
+}
+
+func usage() {
+	names := make([]string, 0, len(subCommands))
+	for n := range subCommands {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString("usage: shexec <command> [flags] [args]\n\nCommands:\n")
+	for _, n := range names {
+		fmt.Fprintf(&b, "  %-8s %s\n", n, subCommands[n].summary)
+	}
+	b.WriteString("\nRun 'shexec <command> -h' for a command's flags.\n")
+	fmt.Fprint(os.Stderr, b.String())
+}
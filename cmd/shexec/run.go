@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/monopole/shexec/scenario"
+)
+
+// runScenario runs each scenario file, reporting to stdout, and
+// optionally to a JUnit XML file.
+func runScenario(argv []string) int {
+	var junitPath string
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(),
+			"usage: shexec run [flags] {scenario.yaml}...\n\n"+
+				"Starts the shell declared in each scenario, and runs\n"+
+				"its steps, checking their output.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&junitPath, "junit", "",
+		"If set, write a JUnit XML report to this file; "+
+			"each scenario file is a test suite.")
+	_ = fs.Parse(argv)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	code := 0
+	var reports []*scenario.Report
+	for _, path := range fs.Args() {
+		s, err := scenario.Load(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			code = 1
+			continue
+		}
+		r := s.Run()
+		_ = r.WriteText(os.Stdout)
+		if !r.Passed() {
+			code = 1
+		}
+		reports = append(reports, r)
+	}
+	if junitPath != "" {
+		if err := writeJUnit(junitPath, reports); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	return code
+}
+
+func writeJUnit(path string, reports []*scenario.Report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	err = scenario.WriteJUnit(f, reports...)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	return err //nolint:wrapcheck
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/monopole/shexec/server"
+)
+
+// runServe serves shell sessions over HTTP until interrupted,
+// then stops all sessions.
+func runServe(argv []string) int {
+	var addr, socket, token string
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(),
+			"usage: shexec serve [flags]\n\n"+
+				"Serves named, long-lived shell sessions over HTTP,\n"+
+				"on a unix domain socket or a loopback address.\n"+
+				"Requests must carry the header\n\n"+
+				"  Authorization: Bearer <token>\n\n"+
+				"For the API, see package\n"+
+				"github.com/monopole/shexec/server.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&addr, "addr", "localhost:7070",
+		"The loopback host and port to listen on.")
+	fs.StringVar(&socket, "socket", "",
+		"If set, listen on this unix domain socket instead of -addr.")
+	fs.StringVar(&token, "token", "",
+		"The token requests must carry; if empty, one is generated\n"+
+			"and written to stderr.")
+	_ = fs.Parse(argv)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	l, err := listen(addr, socket)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if token == "" {
+		if token, err = server.NewToken(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "token %s\n", token)
+	}
+	var hosts []string
+	if socket == "" {
+		// Any Host header will do on a socket, but over TCP, the
+		// Host header must name this server, to defeat DNS rebinding.
+		hosts = loopbackHosts(addr, l.Addr())
+	}
+	h := server.NewHandler(token, hosts...)
+	srv := &http.Server{Handler: h} //nolint:gosec
+	ctx, stop := signal.NotifyContext(
+		context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		_ = srv.Shutdown(context.Background())
+	}()
+	fmt.Fprintf(os.Stderr, "serving on %s\n", l.Addr())
+	code := 0
+	if err = srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, err)
+		code = 1
+	}
+	if err = h.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		code = 1
+	}
+	return code
+}
+
+// listen listens on the socket if given, else on the address,
+// which must be a loopback address, since shells mustn't be
+// offered to the network.  Only the user may use the socket.
+func listen(addr, socket string) (net.Listener, error) {
+	if socket != "" {
+		defer privateFiles()()
+		//nolint:wrapcheck
+		return net.Listen("unix", socket)
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	if host != "localhost" {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			return nil, fmt.Errorf( //nolint:goerr113
+				"%q is not a loopback address", addr)
+		}
+	}
+	//nolint:wrapcheck
+	return net.Listen("tcp", addr)
+}
+
+// loopbackHosts returns the names by which clients may reach the
+// listener on the address: as given, as listened on, and as localhost,
+// all with the port listened on.
+func loopbackHosts(addr string, la net.Addr) []string {
+	host, _, _ := net.SplitHostPort(addr)
+	_, port, _ := net.SplitHostPort(la.String())
+	return []string{
+		net.JoinHostPort(host, port),
+		la.String(),
+		net.JoinHostPort("localhost", port),
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+// privateFiles does nothing where there's no umask;
+// a socket's access is then up to its directory.
+func privateFiles() (restore func()) {
+	return func() {}
+}
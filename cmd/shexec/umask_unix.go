@@ -0,0 +1,12 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// privateFiles makes files created until restore is called
+// accessible only to the user.
+func privateFiles() (restore func()) {
+	old := syscall.Umask(0o177)
+	return func() { syscall.Umask(old) }
+}
@@ -4,8 +4,19 @@ import (
 	"fmt"
 	"io"
 	"os"
+
+	"github.com/monopole/shexec/channeler"
 )
 
+// LineWriter is an optional extension of the io.WriteCloser returned
+// by a Commander's ParseOut or ParseErr.  If a parser implements it,
+// WriteLine is called instead of Write, with the line's metadata.
+// Use this to learn when each line arrived, or how lines on
+// stdOut and stdErr interleave.
+type LineWriter interface {
+	WriteLine(channeler.Line) error
+}
+
 // Commander knows a CLI command,
 // and knows how to parse the command's output.
 type Commander interface {
@@ -20,6 +31,31 @@ type Commander interface {
 	ParseErr() io.WriteCloser
 }
 
+// Unwrapper is implemented by a Commander that wraps another,
+// e.g. a DialogCommander.  The optional extensions of Commander,
+// e.g. OutputLimiter, are looked for on the wrapper, then on the
+// Commander it wraps, and so on, so wrapping doesn't hide them.
+type Unwrapper interface {
+	Unwrap() Commander
+}
+
+// extension returns the first Commander in the chain of wrapped
+// Commanders starting with c that implements E.
+func extension[E any](c Commander) (E, bool) {
+	for c != nil {
+		if e, ok := c.(E); ok {
+			return e, true
+		}
+		u, ok := c.(Unwrapper)
+		if !ok {
+			break
+		}
+		c = u.Unwrap()
+	}
+	var zero E
+	return zero, false
+}
+
 // DiscardCommander discards everything from its parsers.
 type DiscardCommander struct {
 	C string
@@ -91,6 +127,37 @@ func (c *RecallCommander) Reset() {
 func (c *RecallCommander) DataOut() []string { return c.wOut.data }
 func (c *RecallCommander) DataErr() []string { return c.wErr.data }
 
+// Result returns the lines seen on stdOut, and a *StdErrError
+// if any lines were seen on stdErr.
+func (c *RecallCommander) Result() ([]string, error) {
+	if len(c.DataErr()) > 0 {
+		return c.DataOut(), newStdErrError(c.C, c.DataErr())
+	}
+	return c.DataOut(), nil
+}
+
+// RecordCommander remembers all the lines it sees, empty ones too.
+type RecordCommander struct {
+	C    string
+	wOut LineRecorder
+	wErr LineRecorder
+}
+
+// NewRecordCommander returns an instance of RecordCommander.
+func NewRecordCommander(c string) *RecordCommander {
+	return &RecordCommander{C: c}
+}
+
+func (c *RecordCommander) Command() string          { return c.C }
+func (c *RecordCommander) ParseOut() io.WriteCloser { return &c.wOut }
+func (c *RecordCommander) ParseErr() io.WriteCloser { return &c.wErr }
+func (c *RecordCommander) Reset() {
+	c.wErr.Reset()
+	c.wOut.Reset()
+}
+func (c *RecordCommander) DataOut() []string { return c.wOut.Text() }
+func (c *RecordCommander) DataErr() []string { return c.wErr.Text() }
+
 // LineAbsorber remembers all the non-empty lines it sees.
 type LineAbsorber struct{ data []string }
 
@@ -103,3 +170,29 @@ func (ab *LineAbsorber) Write(data []byte) (int, error) {
 	}
 	return len(data), nil
 }
+
+// LineRecorder remembers all the lines it sees, with their metadata.
+// Lines given to Write, rather than WriteLine, have no metadata.
+type LineRecorder struct{ lines []channeler.Line }
+
+func (lr *LineRecorder) Reset()                  { lr.lines = nil }
+func (lr *LineRecorder) Lines() []channeler.Line { return lr.lines }
+func (lr *LineRecorder) Close() error            { return nil }
+
+// Text returns the text of the lines, without metadata.
+func (lr *LineRecorder) Text() []string {
+	result := make([]string, 0, len(lr.lines))
+	for _, line := range lr.lines {
+		result = append(result, string(line.Text))
+	}
+	return result
+}
+
+func (lr *LineRecorder) Write(data []byte) (int, error) {
+	return len(data), lr.WriteLine(channeler.Line{Text: data})
+}
+func (lr *LineRecorder) WriteLine(line channeler.Line) error {
+	line.Text = append([]byte(nil), line.Text...)
+	lr.lines = append(lr.lines, line)
+	return nil
+}
@@ -0,0 +1,104 @@
+package shexec
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ExitStatusSetter is an optional extension of Commander.
+//
+// If the Shell runs in control mode (see channeler.Params.ControlFD),
+// the exit status of each command arrives on the control pipe, and
+// is given to a Commander implementing ExitStatusSetter once Run has
+// succeeded.  Outside control mode, SetExitStatus isn't called.
+type ExitStatusSetter interface {
+	SetExitStatus(status int)
+}
+
+// controlNonceLen is the number of random bytes in a control nonce.
+const controlNonceLen = 8
+
+// newControlNonce returns a random prefix for control tokens, so
+// that a command writing to the control pipe on its own is unlikely
+// to be mistaken for the end of a command.
+func newControlNonce() string {
+	b := make([]byte, controlNonceLen)
+	// Read never returns an error.
+	_, _ = rand.Read(b)
+	return "shexec_" + hex.EncodeToString(b)
+}
+
+// nextControlToken makes a token for the command about to run.
+func (eInf *execInfra) nextControlToken() {
+	eInf.ctlCount++
+	eInf.ctlToken = eInf.ctlNonce + "_" + strconv.FormatUint(eInf.ctlCount, 10)
+}
+
+// controlCommand writes the token and the exit status
+// of the prior command to the control pipe.
+func controlCommand(token string) string {
+	return fmt.Sprintf(`printf '%%s %%d\n' %s "$?" >&3`, token)
+}
+
+// awaitControl reads the control pipe until the token arrives,
+// records the exit status that came with it, then marks both
+// output streams, so that their scans end there.  If the pipe
+// closes first, the scans end when the streams do.  Closing quit
+// stops the wait, so that an abandoned wait can't take the control
+// lines of a later command.
+func (eInf *execInfra) awaitControl(token string, quit <-chan struct{}) {
+	chs := eInf.channels
+	for {
+		var (
+			line string
+			ok   bool
+		)
+		select {
+		case line, ok = <-chs.Control:
+		case <-quit:
+			eInf.lgr.Printf("control; stopped awaiting %s", token)
+			return
+		}
+		if !ok {
+			eInf.lgr.Printf("control; pipe closed awaiting %s", token)
+			return
+		}
+		tok, status, ok := strings.Cut(line, " ")
+		if !ok || tok != token {
+			eInf.lgr.Printf("control; ignoring %q", eInf.lgr.abbrev(line))
+			continue
+		}
+		n, err := strconv.Atoi(status)
+		if err != nil {
+			eInf.lgr.Printf("control; bad status in %q", eInf.lgr.abbrev(line))
+			n = -1
+		}
+		eInf.status.Store(int64(n))
+		eInf.lgr.Printf("control; got %s with status %d", token, n)
+		chs.Mark()
+		return
+	}
+}
+
+// inControl is true if command completion is
+// learned from the control pipe, not from sentinels.
+func (eInf *execInfra) inControl() bool {
+	return eInf.ctlNonce != ""
+}
+
+// scansErr is true if stdErr is scanned for the end of a command,
+// rather than drained.
+func (eInf *execInfra) scansErr() bool {
+	return eInf.haveErrSentinel() || eInf.inControl()
+}
+
+// setExitStatus gives the command its exit status, if wanted.
+func (eInf *execInfra) setExitStatus(c Commander) {
+	s, ok := extension[ExitStatusSetter](c)
+	if ok && eInf.inControl() {
+		s.SetExitStatus(int(eInf.status.Load()))
+	}
+}
@@ -0,0 +1,77 @@
+package shexec_test
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	. "github.com/monopole/shexec"
+	"github.com/monopole/shexec/channeler"
+	"github.com/stretchr/testify/assert"
+)
+
+// statusCommander is a RecallCommander that records its exit status.
+type statusCommander struct {
+	*RecallCommander
+	status int
+}
+
+func (c *statusCommander) SetExitStatus(status int) { c.status = status }
+
+func TestControlFD(t *testing.T) {
+	sh := NewShell(Parameters{
+		Params: channeler.Params{Path: "/bin/sh", ControlFD: true},
+	})
+	assert.NoError(t, sh.Start(timeOutShort))
+
+	run := func(cmd string) *statusCommander {
+		c := &statusCommander{
+			RecallCommander: NewRecallCommander(cmd), status: -99}
+		assert.NoError(t, sh.Run(timeOutShort, c))
+		return c
+	}
+
+	c := run("echo hello; echo oops 1>&2")
+	assert.Equal(t, []string{"hello"}, c.DataOut())
+	assert.Equal(t, []string{"oops"}, c.DataErr())
+	assert.Equal(t, 0, c.status)
+
+	// Output lacking a final newline still arrives, and
+	// nothing of it leaks into the next command's output.
+	c = run("printf 'no newline'")
+	assert.Equal(t, []string{"no newline"}, c.DataOut())
+	c = run("echo next")
+	assert.Equal(t, []string{"next"}, c.DataOut())
+
+	// Sentinel values are just output.
+	c = run("echo " + unlikelyStdOut + "; echo " + unlikelyStdErr + " 1>&2")
+	assert.Equal(t, []string{unlikelyStdOut}, c.DataOut())
+	assert.Equal(t, []string{unlikelyStdErr}, c.DataErr())
+
+	c = run("false")
+	assert.Empty(t, c.DataOut())
+	assert.Equal(t, 1, c.status)
+	c = run("(exit 7)")
+	assert.Equal(t, 7, c.status)
+
+	// The shell's own writes to the control pipe are ignored.
+	c = run("echo bogus 1 >&3; echo after")
+	assert.Equal(t, []string{"after"}, c.DataOut())
+	assert.Equal(t, 0, c.status)
+
+	assert.NoError(t, sh.Stop(timeOutShort, ""))
+}
+
+func TestControlFDTimeoutStopsAwaitingControl(t *testing.T) {
+	sh := NewShell(Parameters{
+		Params: channeler.Params{Path: "/bin/sh", ControlFD: true},
+	})
+	assert.NoError(t, sh.Start(timeOutShort))
+	c := NewRecallCommander("sleep 1")
+	assert.Error(t, sh.Run(100*time.Millisecond, c))
+	// Though the control pipe stays open while sleep runs,
+	// nothing awaits it once Run returns.
+	buf := make([]byte, 1<<20)
+	assert.NotContains(t,
+		string(buf[:runtime.Stack(buf, true)]), "awaitControl")
+}
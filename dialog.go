@@ -0,0 +1,226 @@
+package shexec
+
+import (
+	"regexp"
+	"sync"
+	"time"
+)
+
+// DefaultDialogQuiet is how long output must pause, when a Dialog
+// doesn't say otherwise, before the command is assumed to be done
+// asking questions.
+const DefaultDialogQuiet = 200 * time.Millisecond
+
+// Rule answers a question asked by a running command.
+type Rule struct {
+	// Pattern is matched against each line of output, and against
+	// the start of a line still awaiting its newline, so that a
+	// prompt like "Password: " is seen as soon as it's written.
+	Pattern *regexp.Regexp
+	// Response is sent to the shell's stdIn when Pattern matches.
+	Response string
+	// Respond, if not nil, is called instead of using Response,
+	// with the match followed by its submatches.  It's called from
+	// a goroutine scanning output.  An error ends the Run, as does a
+	// response rejected by the Shell's Policy; since the command is
+	// then left waiting for input, the shell is stopped.
+	Respond func(match []string) (string, error)
+	// Final means the command reads no more input after getting
+	// this response, so the sentinels can be sent right away.
+	Final bool
+}
+
+// Dialog holds the rules for answering a command's questions.
+type Dialog struct {
+	Rules []Rule
+	// Quiet is how long output must pause before the command is
+	// assumed to be done asking questions.  If zero,
+	// DefaultDialogQuiet is used.
+	Quiet time.Duration
+}
+
+// Dialoger is an optional extension of Commander, for commands that
+// ask questions while running, e.g. "Continue? [y/N]".
+//
+// The sentinel commands are normally sent right after the command.
+// A command that reads stdIn would read them as answers, so for a
+// Dialoger they're held back until output pauses for the Dialog's
+// Quiet duration, or until a Final rule fires.  Meanwhile, whenever
+// a rule's Pattern matches output on either stream, the rule's
+// response is sent to stdIn.  Text matched by a rule isn't matched
+// again.
+//
+// Without a SentinelErr, stdErr is discarded, so prompts written
+// there go unseen.
+type Dialoger interface {
+	Dialog() Dialog
+}
+
+// DialogCommander adds a Dialog to a Commander.
+type DialogCommander struct {
+	Commander
+	Rules []Rule
+	Quiet time.Duration
+}
+
+func (c *DialogCommander) Dialog() Dialog {
+	return Dialog{Rules: c.Rules, Quiet: c.Quiet}
+}
+
+func (c *DialogCommander) Unwrap() Commander { return c.Commander }
+
+// dialog applies a Dialog's rules for the duration of one Run.
+type dialog struct {
+	mu    sync.Mutex
+	rules []Rule
+	quiet time.Duration
+	stdIn chan<- string
+	// sendSentinels is called once the questions are over,
+	// unless the Run ends first.
+	sendSentinels func()
+	// vet judges a computed response by the Shell's Policy.
+	vet func(response string) error
+	// done is true once nothing more should be sent to stdIn.
+	done  bool
+	chErr chan error
+	lgr   *shLogger
+}
+
+// startDialog returns a dialog for the Commander,
+// or nil if it's not a Dialoger.
+func (eInf *execInfra) startDialog(c Commander) *dialog {
+	dl, ok := extension[Dialoger](c)
+	if !ok {
+		return nil
+	}
+	d := dl.Dialog()
+	if d.Quiet <= 0 {
+		d.Quiet = DefaultDialogQuiet
+	}
+	return &dialog{
+		rules:         d.Rules,
+		quiet:         d.Quiet,
+		stdIn:         eInf.channels.StdIn,
+		sendSentinels: eInf.sendSentinels,
+		vet: func(response string) error {
+			return eInf.policy.vet(response, eInf.lgr)
+		},
+		chErr: make(chan error, 1),
+		lgr:   eInf.lgr,
+	}
+}
+
+// finish sends the sentinels, if that's not already happened.
+func (dlg *dialog) finish() {
+	dlg.mu.Lock()
+	defer dlg.mu.Unlock()
+	dlg.finishLocked()
+}
+
+func (dlg *dialog) finishLocked() {
+	if dlg.done {
+		return
+	}
+	dlg.done = true
+	dlg.lgr.Println("dialog; sending sentinels")
+	dlg.sendSentinels()
+}
+
+// end stops the dialog without sending the sentinels.
+func (dlg *dialog) end() {
+	dlg.mu.Lock()
+	defer dlg.mu.Unlock()
+	dlg.done = true
+}
+
+// answer sends responses for all rule matches in text,
+// starting at the given offset, and returns the offset
+// following the last match.
+func (dlg *dialog) answer(text []byte, offset int) int {
+	dlg.mu.Lock()
+	defer dlg.mu.Unlock()
+	offset = min(offset, len(text))
+	for !dlg.done {
+		r, loc := dlg.firstMatch(text[offset:])
+		if r == nil {
+			break
+		}
+		match := make([]string, len(loc)/2)
+		for i := range match {
+			if loc[2*i] >= 0 {
+				match[i] = string(text[offset+loc[2*i] : offset+loc[2*i+1]])
+			}
+		}
+		offset += loc[1]
+		response := r.Response
+		if r.Respond != nil {
+			var err error
+			if response, err = r.Respond(match); err != nil {
+				dlg.done = true
+				dlg.chErr <- err
+				break
+			}
+			if err = dlg.vet(response); err != nil {
+				// Not a *PolicyError; the command did run.
+				dlg.done = true
+				dlg.chErr <- shErr(
+					"response to %q rejected; %v", match[0], err)
+				break
+			}
+		}
+		dlg.lgr.Printf("dialog; answering %q with %q", match[0], response)
+		dlg.stdIn <- response
+		if r.Final {
+			dlg.finishLocked()
+		}
+	}
+	return offset
+}
+
+// firstMatch returns the rule matching earliest in the text, with
+// the match's submatch indices.  Empty matches are ignored.
+func (dlg *dialog) firstMatch(text []byte) (*Rule, []int) {
+	var (
+		best    *Rule
+		bestLoc []int
+	)
+	for i := range dlg.rules {
+		r := &dlg.rules[i]
+		loc := r.Pattern.FindSubmatchIndex(text)
+		if loc == nil || loc[0] == loc[1] {
+			continue
+		}
+		if best == nil || loc[0] < bestLoc[0] {
+			best, bestLoc = r, loc
+		}
+	}
+	return best, bestLoc
+}
+
+// dialogSide watches one output stream for questions.
+type dialogSide struct {
+	dlg *dialog
+	// matched is the length of the current line's
+	// prefix already matched by a rule.
+	matched int
+}
+
+func newDialogSides(dlg *dialog) (*dialogSide, *dialogSide) {
+	if dlg == nil {
+		return nil, nil
+	}
+	return &dialogSide{dlg: dlg}, &dialogSide{dlg: dlg}
+}
+
+// line looks for questions in a complete line.
+func (ds *dialogSide) line(text []byte) {
+	ds.dlg.answer(text, ds.matched)
+	ds.matched = 0
+}
+
+// partial looks for questions in the start of a line.
+func (ds *dialogSide) partial(text []byte) {
+	if len(text) > ds.matched {
+		ds.matched = ds.dlg.answer(text, ds.matched)
+	}
+}
@@ -0,0 +1,77 @@
+package shexec_test
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	. "github.com/monopole/shexec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialog(t *testing.T) {
+	sh := NewShell(makeBinShParams())
+	assert.NoError(t, sh.Start(timeOutShort))
+
+	// The prompt lacks a newline.
+	rc := NewRecallCommander(
+		`printf 'Continue? [y/N] '; read ans; echo "got $ans"`)
+	assert.NoError(t, sh.Run(timeOutLong, &DialogCommander{
+		Commander: rc,
+		Rules: []Rule{{
+			Pattern:  regexp.MustCompile(`Continue\? \[y/N\] $`),
+			Response: "y",
+		}},
+	}))
+	assert.Equal(t, []string{"Continue? [y/N] got y"}, rc.DataOut())
+
+	// Several questions, on both streams, answered by callback.  The
+	// Final rule sends the sentinels long before output goes quiet.
+	rc = NewRecallCommander(`
+printf 'Name? ' 1>&2; read n
+printf 'Age of %s? ' "$n"; read a
+echo "$n is $a"`)
+	start := time.Now()
+	assert.NoError(t, sh.Run(timeOutLong, &DialogCommander{
+		Commander: rc,
+		Quiet:     time.Hour,
+		Rules: []Rule{{
+			Pattern:  regexp.MustCompile(`Name\? `),
+			Response: "Ann",
+		}, {
+			Pattern: regexp.MustCompile(`Age of (\w+)\? `),
+			Respond: func(m []string) (string, error) {
+				return fmt.Sprint(len(m[1]) * 10), nil
+			},
+			Final: true,
+		}},
+	}))
+	assert.Less(t, time.Since(start), timeOutLong)
+	assert.Equal(t, []string{"Age of Ann? Ann is 30"}, rc.DataOut())
+	assert.Equal(t, []string{"Name? "}, rc.DataErr())
+
+	// Without questions, the sentinels are sent once output is quiet.
+	rc = NewRecallCommander("echo hello")
+	assert.NoError(t, sh.Run(timeOutLong, &DialogCommander{
+		Commander: rc,
+		Quiet:     timeOutTiny,
+	}))
+	assert.Equal(t, []string{"hello"}, rc.DataOut())
+	assert.NoError(t, sh.Stop(timeOutShort, ""))
+}
+
+func TestDialogRespondError(t *testing.T) {
+	sh := NewShell(makeBinShParams())
+	assert.NoError(t, sh.Start(timeOutShort))
+	oops := errors.New("oops")
+	err := sh.Run(timeOutLong, &DialogCommander{
+		Commander: NewRecallCommander("printf 'Password: '; read p"),
+		Rules: []Rule{{
+			Pattern: regexp.MustCompile(`Password: `),
+			Respond: func([]string) (string, error) { return "", oops },
+		}},
+	})
+	assert.ErrorIs(t, err, oops)
+}
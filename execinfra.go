@@ -1,10 +1,11 @@
 package shexec
 
 import (
+	"bytes"
 	"fmt"
 	"io"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/monopole/shexec/channeler"
@@ -12,19 +13,27 @@ import (
 
 // NewShell returns a new Shell built from Parameters in the off state.
 func NewShell(p Parameters) Shell {
-	return NewShellRaw(
-		func() (*channeler.Channels, error) {
+	// The Shell's own Redactor hides the secrets of Params.Redactor,
+	// and those of sensitive commands while they run.
+	red := &channeler.Redactor{}
+	red.Include(p.Redactor)
+	p.Redactor = red
+	p.DetailedLogging = p.DetailedLogging || p.EnableDetailedLogging
+	return Intercept(newShell(&execInfra{
+		chMaker: func() (*channeler.Channels, error) {
 			if err := p.Validate(); err != nil {
 				return nil, err
 			}
-			verboseLoggingEnabled, channeler.VerboseLoggingEnabled =
-				p.EnableDetailedLogging, p.EnableDetailedLogging
 			//nolint:wrapcheck
 			return channeler.Start(&p.Params)
 		},
-		p.SentinelOut,
-		p.SentinelErr,
-	)
+		sentinelOut: &p.SentinelOut,
+		sentinelErr: &p.SentinelErr,
+		limits:      p.OutputLimits,
+		policy:      p.Policy,
+		red:         red,
+		lgr:         newLogger(p.DetailedLogging, red),
+	}), p.Interceptors...)
 }
 
 const errCategory = "shexec infra"
@@ -35,7 +44,8 @@ func shErr(format string, a ...any) error {
 }
 
 func shErrCaused(err error, format string, a ...any) error {
-	return fmt.Errorf("%s; %s; %w", errCategory, fmt.Sprintf(format, a...), err)
+	return fmt.Errorf(
+		"%s; %s; %w", errCategory, fmt.Sprintf(format, a...), err)
 }
 
 // channelsMakerF can be mocked in tests with bare channels
@@ -46,17 +56,19 @@ type channelsMakerF func() (*channeler.Channels, error)
 // the given channels-maker function and the two sentinels.
 // Allows testing with injected channels instead of a real shell subprocess.
 func NewShellRaw(f channelsMakerF, so Sentinel, se Sentinel) Shell {
-	// Uncomment when debugging.
-	// verboseLoggingEnabled, channeler.VerboseLoggingEnabled = true, true
-	return &execMutex{
-		state: &execStateOff{
-			infra: &execInfra{
-				chMaker:     f,
-				sentinelOut: &so,
-				sentinelErr: &se,
-			},
-		},
-	}
+	red := &channeler.Redactor{}
+	return newShell(&execInfra{
+		chMaker:     f,
+		sentinelOut: &so,
+		sentinelErr: &se,
+		red:         red,
+		// Make this true when debugging.
+		lgr: newLogger(false, red),
+	})
+}
+
+func newShell(infra *execInfra) Shell {
+	return &execMutex{state: &execStateOff{infra: infra}}
 }
 
 // execInfra holds Shell infrastructure shared by all Shell states.
@@ -70,102 +82,304 @@ type execInfra struct {
 	// chMaker is used to make a fresh set of channels on Start.
 	chMaker channelsMakerF
 
+	// limits bounds the output forwarded to parsers.
+	limits OutputLimits
+
+	// policy, if not nil, vets commands before they're sent.
+	policy *Policy
+
 	// channels holds all the pipes in and out of the shell.
 	channels *channeler.Channels
 
-	// chInfraErr is used by any internal infrastructure
-	// thread to signal a fatal error that requires a
-	// restart of the subprocess.
-	chInfraErr chan error
+	// cursorOut and cursorErr track positions in the
+	// stdOut and stdErr streams across calls to Run.
+	cursorOut *streamCursor
+	cursorErr *streamCursor
+
+	// chActivity gets a signal whenever the cursors
+	// receive output, even if only part of a line.
+	chActivity chan struct{}
+
+	// ctlNonce, if not empty, puts the Shell in control mode; command
+	// completion is learned from the control pipe, not from sentinels.
+	// Each command gets a ctlToken made from the nonce and ctlCount.
+	ctlNonce string
+	ctlCount uint64
+	ctlToken string
+
+	// status holds the exit status of the last command in control mode.
+	status atomic.Int64
+
+	// red hides secrets from the Shell's logs and errors.
+	red *channeler.Redactor
+
+	// lgr logs the Shell's workings.
+	lgr *shLogger
 }
 
-func (eInf *execInfra) infraStart(d time.Duration) error {
-	var err error
+func (eInf *execInfra) infraStart(d time.Duration) (err error) {
+	defer func() { err = eInf.red.RedactError(err) }()
 	eInf.channels, err = eInf.chMaker()
 	if err != nil {
 		return shErrCaused(err, "chMaker start failure")
 	}
-	eInf.chInfraErr = make(chan error)
-	if !eInf.haveErrSentinel() {
+	eInf.chActivity = make(chan struct{}, 1)
+	eInf.cursorOut = newStreamCursor(
+		"stdOut", eInf.channels.StdOut, eInf.chActivity, eInf.lgr)
+	eInf.cursorErr = newStreamCursor(
+		"stdErr", eInf.channels.StdErr, eInf.chActivity, eInf.lgr)
+	eInf.ctlNonce = ""
+	if eInf.channels.Control != nil && eInf.channels.Mark != nil {
+		eInf.lgr.Println("infraStart; using the control pipe, not sentinels")
+		eInf.ctlNonce = newControlNonce()
+	}
+	if !eInf.scansErr() {
 		// Fire off a thread to drain the stdErr channel
 		// so that it doesn't fill up and block the shell.
 		// No need for such a drain on stdOut, as we'll
 		// always want to parse it normally.
+		stdErr, chActivity := eInf.channels.StdErr, eInf.chActivity
 		go func() {
-			lgr.Println("infraStart; no err sentinel, will drain stdErr")
-			for range eInf.channels.StdErr {
-				// just throw it away
+			eInf.lgr.Println("infraStart; no err sentinel, will drain stdErr")
+			for chunk := range stdErr {
+				// just throw it away, but note the activity.
+				chunk.Release()
+				select {
+				case chActivity <- struct{}{}:
+				default:
+				}
 			}
 		}()
 	}
-	lgr.Println("infraStart; testing sentinels to make sure they work")
-	gotSentinels := eInf.fireOffSentinelFilters(DevNull, DevNull)
+	eInf.lgr.Println("infraStart; testing sentinels to make sure they work")
+	scan := eInf.fireOffSentinelFilters(DevNull, DevNull)
+	defer scan.stop()
 	select {
-	case <-gotSentinels:
-		lgr.Println("infraStart; got sentinels at startup, yay")
+	case err = <-scan.done:
+		if err != nil {
+			eInf.lgr.Println("infraStart; got infra error in start call")
+			return err
+		}
+		eInf.lgr.Println("infraStart; got sentinels at startup, yay")
 		return nil
-	case err = <-eInf.chInfraErr:
-		lgr.Println("infraStart; got infra error in start call")
-		return err
 	case <-time.After(d):
 		return shErr("starting, but no sentinels found after %s", d)
 	}
 }
 
-func (eInf *execInfra) infraRun(d time.Duration, c Commander) error {
+func (eInf *execInfra) infraRun(
+	d time.Duration, c Commander, ro runOptions) (err error) {
 	if c == nil {
 		return shErr("must specify a non-nil commander to Run")
 	}
-	lgr.Printf("infraRun; starting: %q", c.Command())
-	eInf.channels.StdIn <- c.Command()
-	lgr.Printf("infraRun; enqueued command %s", abbrev(c.Command()))
-	gotSentinels := eInf.fireOffSentinelFilters(c.ParseOut(), c.ParseErr())
-	select {
-	case <-gotSentinels:
-		lgr.Printf(
-			"infraRun; got sentinels after command %q", abbrev(c.Command()))
-		return nil
-	case err := <-eInf.channels.Done:
-		lgr.Printf(
-			"infraRun; channels.Done ended unexpectedly with err: %s",
-			err.Error())
+	defer eInf.engageSensitive(c)()
+	if rr, ok := extension[resultRedactable](c); ok {
+		rr.redactWith(eInf.resultRedactor(c))
+	}
+	// Errors are redacted while a sensitive command is still hidden.
+	defer func() { err = eInf.red.RedactError(err) }()
+	if err := eInf.policy.vet(c.Command(), eInf.lgr); err != nil {
 		return err
-	case err := <-eInf.chInfraErr:
-		lgr.Println("infraRun; got infra error in run call")
+	}
+	if err := eInf.policy.vetInput(c, eInf.lgr); err != nil {
+		return err
+	}
+	if err := eInf.checkBinary(c); err != nil {
 		return err
-	case <-time.After(d):
-		lgr.Printf("infraRun; no sentinels found after %s", d)
-		return shErr(
-			"running %q, no sentinels found after %s",
-			abbrev(c.Command()), d)
+	}
+	if isBinary(c) && eInf.channels.Binary != nil {
+		// Output is streamed, though it lacks newlines.
+		eInf.channels.Binary(true)
+		defer eInf.channels.Binary(false)
+	}
+	lgr, cmd := eInf.lgr, eInf.lgr.abbrev(c.Command())
+	lgr.Printf("infraRun; starting: %q", c.Command())
+	eInf.channels.StdIn <- c.Command()
+	lgr.Printf("infraRun; enqueued command %s", cmd)
+	parseOut, parseErr, truncation := eInf.limitParsers(c)
+	eInf.drainActivity()
+	dlg := eInf.startDialog(c)
+	scan := eInf.scanForSentinels(parseOut, parseErr, dlg, isBinary(c))
+	// Whatever happens, the scans end before Run returns.
+	defer scan.stop()
+	// fed stays nil unless there's a payload to stream.
+	fed := eInf.feedPayload(c)
+	if dlg == nil && fed == nil {
+		eInf.sendSentinels()
+	}
+	deadline := time.After(d)
+	// idle stays nil, blocking forever, unless an idle timeout is wanted.
+	var (
+		idle      <-chan time.Time
+		idleTimer *time.Timer
+	)
+	if ro.idleTimeout > 0 {
+		idleTimer = time.NewTimer(ro.idleTimeout)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+	// Likewise quiet and dlgErr, unless the command has a dialog.
+	var (
+		quiet      <-chan time.Time
+		quietTimer *time.Timer
+		dlgErr     <-chan error
+	)
+	if dlg != nil {
+		defer dlg.end()
+		quietTimer = time.NewTimer(dlg.quiet)
+		defer quietTimer.Stop()
+		dlgErr = dlg.chErr
+		if fed == nil {
+			quiet = quietTimer.C
+		}
+	}
+	for {
+		select {
+		case <-eInf.chActivity:
+			if idleTimer != nil {
+				idleTimer.Reset(ro.idleTimeout)
+			}
+			if quietTimer != nil {
+				quietTimer.Reset(dlg.quiet)
+			}
+		case err := <-fed:
+			if err != nil {
+				return shErrCaused(
+					err, "feeding payload to %q", cmd)
+			}
+			lgr.Printf("infraRun; fed payload to %q", cmd)
+			fed = nil
+			if dlg == nil {
+				eInf.sendSentinels()
+			} else {
+				// The questions may begin.
+				quietTimer.Reset(dlg.quiet)
+				quiet = quietTimer.C
+			}
+		case <-quiet:
+			lgr.Printf("infraRun; no output for %s, ending dialog", dlg.quiet)
+			dlg.finish()
+			quiet = nil
+		case err := <-dlgErr:
+			return shErrCaused(
+				err, "dialog failed running %q", cmd)
+		case <-idle:
+			lgr.Printf("infraRun; no output for %s", ro.idleTimeout)
+			return &TimeoutError{
+				msg: fmt.Sprintf(
+					"%s; running %q, no output for %s",
+					errCategory, cmd, ro.idleTimeout),
+				kind: ErrIdleTimeout,
+			}
+		case err := <-scan.done:
+			if err != nil {
+				lgr.Println("infraRun; got infra error in run call")
+				return err
+			}
+			lgr.Printf(
+				"infraRun; got sentinels after command %q", cmd)
+			eInf.setExitStatus(c)
+			return truncation()
+		case err := <-eInf.channels.Done:
+			lgr.Printf(
+				"infraRun; channels.Done ended unexpectedly with err: %v", err)
+			// The shell is gone.  Let the scanners drain whatever it left
+			// behind, so the parsers see all of it, and prefer their
+			// account of what went wrong.
+			select {
+			case scanErr := <-scan.done:
+				if scanErr != nil {
+					return scanErr
+				}
+			case <-deadline:
+			}
+			if err == nil {
+				return shErr(
+					"shell exited while running %q", cmd)
+			}
+			return err
+		case <-deadline:
+			lgr.Printf("infraRun; no sentinels found after %s", d)
+			return &TimeoutError{
+				msg: fmt.Sprintf(
+					"%s; running %q, no sentinels found after %s",
+					errCategory, cmd, d),
+				kind: ErrDeadline,
+			}
+		}
 	}
 }
 
-func (eInf *execInfra) infraStop(d time.Duration, c bareCommand) error {
+func (eInf *execInfra) infraStop(
+	d time.Duration, c bareCommand) (err error) {
+	defer func() { err = eInf.red.RedactError(err) }()
 	if c != "" {
-		lgr.Printf("infraStop; sending final command %q to stdin", c)
+		eInf.lgr.Printf("infraStop; sending final command %q to stdin", c)
 		eInf.channels.StdIn <- string(c)
-		lgr.Printf("infraStop; successfully enqueued stop command %q", c)
+		eInf.lgr.Printf("infraStop; successfully enqueued stop command %q", c)
 	} else {
-		lgr.Printf("infraStop; no final command")
+		eInf.lgr.Printf("infraStop; no final command")
 		// A possible problem here is that if the last command sent
 		// was the error sentinel, then the process will exit with whatever
 		// code sits in $?, likely 127 ("command not found").
 		// To avoid this, send the error sentinel _before_ the out sentinel.
 	}
 	close(eInf.channels.StdIn)
-	close(eInf.chInfraErr)
-	eInf.chInfraErr = nil // Assure that this will block if used in select.
 	select {
 	case hopefullyNil := <-eInf.channels.Done:
-		lgr.Printf("infraStop; signal on Done = %s", hopefullyNil)
+		eInf.lgr.Printf("infraStop; signal on Done = %v", hopefullyNil)
 		return hopefullyNil
 	case <-time.After(d):
-		lgr.Printf("infraStop; timeout of %s expired", d)
+		eInf.lgr.Printf("infraStop; timeout of %s expired", d)
 		return shErr("stop failure; shell not done after %s", d)
 	}
 }
 
+// abandon gives up on a shell that failed to Run a command.  It
+// interrupts the shell, if possible, and closes stdIn, so that the
+// shell exits, then drains the output channels in the background,
+// so that the channeler's goroutines can finish.
+func (eInf *execInfra) abandon() {
+	chs, lgr := eInf.channels, eInf.lgr
+	lgr.Println("abandon; interrupting shell and closing stdIn")
+	if chs.Interrupt != nil {
+		if err := chs.Interrupt(); err != nil {
+			lgr.Printf("abandon; interrupt failed: %v", err)
+		}
+	}
+	close(chs.StdIn)
+	go func() {
+		for chunk := range chs.StdOut {
+			chunk.Release()
+		}
+	}()
+	go func() {
+		for chunk := range chs.StdErr {
+			chunk.Release()
+		}
+	}()
+	if chs.Control != nil {
+		go func() {
+			for line := range chs.Control {
+				lgr.Printf("abandon; ignoring control %q", lgr.abbrev(line))
+			}
+		}()
+	}
+	go func() {
+		for err := range chs.Done {
+			lgr.Printf("abandon; signal on Done = %v", err)
+		}
+	}()
+}
+
+// drainActivity discards any activity signal left from a prior call.
+func (eInf *execInfra) drainActivity() {
+	select {
+	case <-eInf.chActivity:
+	default:
+	}
+}
+
 func (eInf *execInfra) haveErrSentinel() bool {
 	return eInf.sentinelErr.C != ""
 }
@@ -173,72 +387,174 @@ func (eInf *execInfra) haveErrSentinel() bool {
 // fireOffSentinelFilters sends in the sentinel commands and scans
 // the two output streams for sentinel values, passing everything
 // that is not a sentinel value to the two respective parsers.
-// When both sentinels are found, a signal is sent on the returned channel.
+// See scanForSentinels for what's sent on the returned channel.
 func (eInf *execInfra) fireOffSentinelFilters(
-	stdOut, stdErr io.WriteCloser) <-chan bool {
-	var sentinelWait sync.WaitGroup
+	stdOut, stdErr io.WriteCloser) *sentinelScan {
+	// Scan first, as that makes the control token.
+	scan := eInf.scanForSentinels(stdOut, stdErr, nil, false)
+	eInf.sendSentinels()
+	return scan
+}
 
+// sendSentinels sends the sentinel commands to the shell,
+// the stdErr sentinel first.  In control mode, it instead sends
+// the command that reports completion on the control pipe.
+func (eInf *execInfra) sendSentinels() {
+	if eInf.inControl() {
+		eInf.lgr.Printf("fire; sending control command for %s", eInf.ctlToken)
+		eInf.channels.StdIn <- controlCommand(eInf.ctlToken)
+		return
+	}
 	if eInf.haveErrSentinel() {
-		sentinelWait.Add(1)
-		lgr.Printf(
+		eInf.lgr.Printf(
 			"fire; sending sentinelErr command %q to stdIn", eInf.sentinelErr.C)
 		eInf.channels.StdIn <- eInf.sentinelErr.C
-		lgr.Printf(
+		eInf.lgr.Printf(
 			"fire; successfully enqueued sentinelErr command %q",
 			eInf.sentinelErr.C)
-		go scanForSentinel(
-			eInf.channels.StdErr, "stdErr", &sentinelWait, stdErr,
-			eInf.sentinelErr.V, eInf.chInfraErr)
 	}
-
-	sentinelWait.Add(1)
-	lgr.Printf(
+	eInf.lgr.Printf(
 		"fire; sending sentinelOut command %q to stdIn", eInf.sentinelOut.C)
 	eInf.channels.StdIn <- eInf.sentinelOut.C
-	lgr.Printf(
+	eInf.lgr.Printf(
 		"fire; successfully enqueued sentinelOut command %q",
 		eInf.sentinelOut.C)
-	go scanForSentinel(
-		eInf.channels.StdOut, "stdOut", &sentinelWait, stdOut,
-		eInf.sentinelOut.V, eInf.chInfraErr)
+}
 
-	gotSentinels := make(chan bool)
+// scanForSentinels scans the two output streams for sentinel values,
+// passing everything that is not a sentinel value to the two
+// respective parsers, and showing it to the dialog, if not nil.
+// When both scans finish, the first error encountered (or nil,
+// if both sentinels were found) is sent on the done channel of the
+// returned sentinelScan, which must be stopped once it's no longer
+// of interest.
+// In control mode, the scans instead end at the boundary marked
+// once the control pipe reports the command's completion, and
+// if binary is true, the parsers get the output exactly as read.
+// Waiting for both scans, rather than for the first error, assures
+// that all output preceding an error reaches the parsers before
+// Run returns.
+func (eInf *execInfra) scanForSentinels(
+	stdOut, stdErr io.WriteCloser, dlg *dialog, binary bool) *sentinelScan {
+	var (
+		sentinelWait sync.WaitGroup
+		firstErr     firstError
+	)
+	gotSentinels := make(chan error, 1)
+	ss := &sentinelScan{done: gotSentinels, quit: make(chan struct{})}
+	// The cursors are the scans' own until they're stopped.
+	cursorOut, cursorErr := eInf.cursorOut, eInf.cursorErr
+	cursorOut.quit, cursorErr.quit = ss.quit, ss.quit
+	dsOut, dsErr := newDialogSides(dlg)
+	valueOut, valueErr := []byte(eInf.sentinelOut.V), []byte(eInf.sentinelErr.V)
+	if eInf.inControl() {
+		valueOut, valueErr = nil, nil
+		eInf.nextControlToken()
+		ss.wg.Add(1)
+		go func(token string) {
+			defer ss.wg.Done()
+			eInf.awaitControl(token, ss.quit)
+		}(eInf.ctlToken)
+	}
+	scan := scanForSentinel
+	if binary {
+		scan = scanRaw
+	}
+
+	scansErr := eInf.scansErr()
+	if scansErr {
+		sentinelWait.Add(1)
+		go func() {
+			defer sentinelWait.Done()
+			firstErr.set(scan(cursorErr, stdErr, valueErr, dsErr))
+		}()
+	}
+
+	sentinelWait.Add(1)
 	go func() {
-		if eInf.haveErrSentinel() {
-			lgr.Printf("fire; awaiting both sentinels")
+		defer sentinelWait.Done()
+		firstErr.set(scan(cursorOut, stdOut, valueOut, dsOut))
+	}()
+
+	ss.wg.Add(1)
+	go func() {
+		defer ss.wg.Done()
+		if scansErr {
+			eInf.lgr.Printf("fire; awaiting both sentinels")
 		} else {
-			lgr.Printf("fire; awaiting stdOut sentinel")
+			eInf.lgr.Printf("fire; awaiting stdOut sentinel")
 		}
 		sentinelWait.Wait()
-		lgr.Printf("fire; done with sentinelWait.Wait")
-		gotSentinels <- true
+		eInf.lgr.Printf("fire; done with sentinelWait.Wait")
+		gotSentinels <- firstErr.get()
 	}()
-	return gotSentinels
+	return ss
+}
+
+// sentinelScan is a scan of both output streams
+// for the end of a command, as started by scanForSentinels.
+type sentinelScan struct {
+	// done gets the outcome of the scan.
+	done <-chan error
+	// quit is closed to make the scan stop early.
+	quit chan struct{}
+	// wg counts the scan's goroutines.
+	wg sync.WaitGroup
+}
+
+// stop ends the scan, if it hasn't ended already, and waits for
+// its goroutines to exit, so that nothing more is read from the
+// streams or written to the parsers.
+func (ss *sentinelScan) stop() {
+	close(ss.quit)
+	ss.wg.Wait()
 }
 
-// scanForSentinel is a thread that reads from a channel (stdOut or stdErr)
+// firstError retains the first non-nil error it's given.
+type firstError struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (fe *firstError) set(err error) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	if fe.err == nil {
+		fe.err = err
+	}
+}
+
+func (fe *firstError) get() error {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	return fe.err
+}
+
+// scanForSentinel reads lines from a stream (stdOut or stdErr)
 // and looks for sentinel response values.
 // When a line has a sentinel value, the command parser is closed, and
-// sentinelWait.Done is called signalling that a sentinel has been acquired
-// and the thread ends happily.
-// If the line doesn't have a sentinel, it's forwarded to the parser and the
-// thread continues scanning and forwarding.
-// If the input channel closes without detection of a sentinel value, an error
-// is dumped into chErr.
-//
-//nolint:gocognit
+// nil is returned, signalling that a sentinel has been acquired.
+// If the line doesn't have a sentinel, it's forwarded to the parser and
+// scanning continues.
+// If the stream closes without detection of a sentinel value, an error
+// is returned.  If ds is not nil, it's shown the output as it arrives.
+// If senValue is empty, as in control mode, the scan instead ends
+// happily at a boundary in the stream.
 func scanForSentinel(
-	stream <-chan string,
-	name string,
-	sentinelWait *sync.WaitGroup,
+	stream *streamCursor,
 	parser io.WriteCloser,
-	senValue string,
-	chErr chan<- error,
-) {
+	senValue []byte,
+	ds *dialogSide,
+) error {
+	name, lgr := stream.name, stream.lgr
 	lgr.Printf("scan %s; awaiting process output", name)
-	for line := range stream {
-		lgr.Printf("scan %s; got line: %q", name, abbrev(line))
-		if p := strings.TrimSuffix(line, senValue); len(p) < len(line) {
+	for {
+		line, ok := stream.nextLine(ds)
+		if !ok {
+			break
+		}
+		p, found := bytes.CutSuffix(line.Text, senValue)
+		if found && len(senValue) > 0 {
 			// Sentinel value found at end of line.
 			// Stop reading stream and return.
 			lgr.Printf(
@@ -247,40 +563,58 @@ func scanForSentinel(
 				// Oops, we have something on the command line *before*
 				// the sentinel - send it to the parser as it might be
 				// a valid command.
-				lgr.Printf("scan %s; writing partial line %q", name, abbrev(p))
-				if _, err := parser.Write([]byte(p)); err != nil {
-					chErr <- shErrCaused(
-						err,
-						"problem writing partial %q to %s parser",
-						p, name)
-					return
+				lgr.Printf("scan %s; writing partial line %q",
+					name, lgr.abbrev(string(p)))
+				line.Text = p
+				if err := writeLine(parser, line); err != nil {
+					return shErrCaused(
+						err, "problem writing partial %q to %s parser", p, name)
 				}
 			}
 			lgr.Printf("scan %s; sentinel in hand, closing", name)
 			if err := parser.Close(); err != nil {
-				chErr <- shErrCaused(err, "problem (1) closing %s parser", name)
-				return
+				return shErrCaused(err, "problem (1) closing %s parser", name)
 			}
-			sentinelWait.Done()
 			// This is the happy exit.
 			lgr.Printf("scan %s; happily closed", name)
-			return
+			return nil
+		}
+		if lgr.enabled() {
+			lgr.Printf("scan %s; forwarding non-sentinel line %q",
+				name, lgr.abbrev(string(line.Text)))
 		}
-		lgr.Printf(
-			"scan %s; forwarding non-sentinel line %q", name, abbrev(line))
 		// Pass the data on.
-		if _, err := parser.Write([]byte(line)); err != nil {
-			chErr <- shErrCaused(
-				err, "problem writing line %q to %s parser", abbrev(line), name)
-			return
+		if err := writeLine(parser, line); err != nil {
+			return shErrCaused(
+				err, "problem writing line %q to %s parser",
+				lgr.abbrev(string(line.Text)), name)
 		}
-		lgr.Printf("scan %s; awaiting process output", name)
 	}
 	if err := parser.Close(); err != nil {
-		chErr <- shErrCaused(err, "problem (2) closing %s parser", name)
-		return
+		return shErrCaused(err, "problem (2) closing %s parser", name)
+	}
+	if stream.takeBoundary() {
+		lgr.Printf("scan %s; reached boundary, closed", name)
+		return nil
+	}
+	if stream.stopped() {
+		return shErr("%s scan stopped", name)
+	}
+	if len(senValue) == 0 {
+		return shErr("%s closed before command completed", name)
 	}
 	lgr.Printf("%s closed before sentinel %q found", name, senValue)
 	// It's likely that the subprocess crashed/ended on error.
-	chErr <- shErr("%s closed before sentinel %q found", name, senValue)
+	return shErr("%s closed before sentinel %q found", name, senValue)
+}
+
+// writeLine passes a line to a parser, using WriteLine if available.
+func writeLine(parser io.Writer, line channeler.Line) error {
+	if lw, ok := parser.(LineWriter); ok {
+		//nolint:wrapcheck
+		return lw.WriteLine(line)
+	}
+	_, err := parser.Write(line.Text)
+	//nolint:wrapcheck
+	return err
 }
@@ -22,10 +22,15 @@ func (r *execMutex) Start(d time.Duration) (err error) {
 	return
 }
 
-func (r *execMutex) Run(d time.Duration, c Commander) (err error) {
+func (r *execMutex) Run(d time.Duration, c Commander) error {
+	return r.RunWith(d, c)
+}
+
+func (r *execMutex) RunWith(
+	d time.Duration, c Commander, opts ...RunOption) (err error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	r.state, err = r.state.subRun(d, c)
+	r.state, err = r.state.subRun(d, c, makeRunOptions(opts))
 	return
 }
 
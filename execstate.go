@@ -8,6 +8,6 @@ type bareCommand string
 // Every Shell state must implement execState.
 type execState interface {
 	subStart(time.Duration) (execState, error)
-	subRun(time.Duration, Commander) (execState, error)
+	subRun(time.Duration, Commander, runOptions) (execState, error)
 	subStop(time.Duration, bareCommand) (execState, error)
 }
@@ -1,6 +1,7 @@
 package shexec
 
 import (
+	"errors"
 	"time"
 )
 
@@ -14,8 +15,22 @@ func (exIdle *execStateIdle) subStart(_ time.Duration) (execState, error) {
 }
 
 func (exIdle *execStateIdle) subRun(
-	d time.Duration, c Commander) (execState, error) {
-	if err := exIdle.infra.infraRun(d, c); err != nil {
+	d time.Duration, c Commander, ro runOptions) (execState, error) {
+	if err := exIdle.infra.infraRun(d, c, ro); err != nil {
+		var (
+			te *TruncationError
+			pe *PolicyError
+			be *BinaryError
+		)
+		if errors.As(err, &te) {
+			// Output was cut short, but the shell is fine.
+			return exIdle, err
+		}
+		if errors.As(err, &pe) || errors.As(err, &be) {
+			// The command was never sent.
+			return exIdle, err
+		}
+		exIdle.infra.abandon()
 		return &execStateOff{infra: exIdle.infra}, err
 	}
 	return exIdle, nil
@@ -16,8 +16,8 @@ func (exOff *execStateOff) subStart(d time.Duration) (execState, error) {
 	return &execStateIdle{infra: exOff.infra}, nil
 }
 
-func (exOff *execStateOff) subRun(_ time.Duration, _ Commander) (
-	execState, error) {
+func (exOff *execStateOff) subRun(
+	_ time.Duration, _ Commander, _ runOptions) (execState, error) {
 	return exOff, shErr("run called, but shell not started yet")
 }
 
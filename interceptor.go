@@ -0,0 +1,108 @@
+package shexec
+
+import (
+	"fmt"
+	"time"
+)
+
+// Op names an operation on a Shell.
+type Op int
+
+const (
+	OpStart Op = iota
+	OpRun
+	OpStop
+)
+
+func (o Op) String() string {
+	switch o {
+	case OpStart:
+		return "start"
+	case OpRun:
+		return "run"
+	case OpStop:
+		return "stop"
+	default:
+		return fmt.Sprintf("Op(%d)", int(o))
+	}
+}
+
+// Call is a call to a Shell's Start, Run or Stop,
+// as seen by an Interceptor.
+type Call struct {
+	Op Op
+	// Timeout is the duration given to the call.
+	Timeout time.Duration
+	// Commander and Options are the arguments to Run or RunWith.
+	Commander Commander
+	Options   []RunOption
+	// ExitCommand is the command given to Stop.
+	ExitCommand string
+}
+
+// Invoker carries out a Call.
+type Invoker func(call *Call) error
+
+// Interceptor wraps every call to a Shell's Start, Run and Stop.
+//
+// An Interceptor may change the Call, e.g. replace its Commander,
+// before passing it on to next; reject it by returning an error
+// without calling next; note the error and duration of next, and
+// consult the Commander afterward; or call next more than once,
+// e.g. to retry.  A rejected call never reaches the Shell, so it
+// doesn't change the Shell's state.
+//
+// Interceptors run outside the Shell's lock; if the Shell is used
+// from many goroutines, they may run concurrently.
+type Interceptor func(call *Call, next Invoker) error
+
+// Intercept returns a Shell whose calls pass through the
+// interceptors, the first of them outermost.
+// See also Parameters.Interceptors.
+func Intercept(sh Shell, interceptors ...Interceptor) Shell {
+	if len(interceptors) == 0 {
+		return sh
+	}
+	//nolint:wrapcheck
+	invoke := func(call *Call) error {
+		switch call.Op {
+		case OpStart:
+			return sh.Start(call.Timeout)
+		case OpRun:
+			return RunWith(
+				sh, call.Timeout, call.Commander, call.Options...)
+		case OpStop:
+			return sh.Stop(call.Timeout, call.ExitCommand)
+		default:
+			return shErr("unknown shell operation %s", call.Op)
+		}
+	}
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		ic, next := interceptors[i], invoke
+		invoke = func(call *Call) error { return ic(call, next) }
+	}
+	return &interceptedShell{invoke: invoke}
+}
+
+// interceptedShell implements Shell, passing calls to an Invoker.
+type interceptedShell struct {
+	invoke Invoker
+}
+
+func (is *interceptedShell) Start(d time.Duration) error {
+	return is.invoke(&Call{Op: OpStart, Timeout: d})
+}
+
+func (is *interceptedShell) Run(d time.Duration, c Commander) error {
+	return is.RunWith(d, c)
+}
+
+func (is *interceptedShell) RunWith(
+	d time.Duration, c Commander, opts ...RunOption) error {
+	return is.invoke(
+		&Call{Op: OpRun, Timeout: d, Commander: c, Options: opts})
+}
+
+func (is *interceptedShell) Stop(d time.Duration, c string) error {
+	return is.invoke(&Call{Op: OpStop, Timeout: d, ExitCommand: c})
+}
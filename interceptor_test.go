@@ -0,0 +1,92 @@
+package shexec_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/monopole/shexec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterceptors(t *testing.T) {
+	var log []string
+	// audit notes each call, and its outcome.
+	audit := func(call *Call, next Invoker) error {
+		start := time.Now()
+		err := next(call)
+		assert.Positive(t, time.Since(start))
+		entry := call.Op.String()
+		if call.Commander != nil {
+			entry += " " + call.Commander.Command()
+		}
+		log = append(log, fmt.Sprintf("%s; %v", entry, err))
+		return err
+	}
+	errNotAllowed := errors.New("not allowed")
+	allow := func(call *Call, next Invoker) error {
+		if call.Op == OpRun &&
+			strings.HasPrefix(call.Commander.Command(), "rm ") {
+			return errNotAllowed
+		}
+		return next(call)
+	}
+	// shout replaces the Commander.
+	shout := func(call *Call, next Invoker) error {
+		if call.Op == OpRun {
+			rc, ok := call.Commander.(*RecallCommander)
+			if ok && strings.HasPrefix(rc.C, "echo ") {
+				rc.C += " | tr a-z A-Z"
+			}
+		}
+		return next(call)
+	}
+	// flaky fails the first start.
+	starts := 0
+	flaky := func(call *Call, next Invoker) error {
+		if call.Op == OpStart {
+			starts++
+			if starts == 1 {
+				return errors.New("flaky")
+			}
+		}
+		return next(call)
+	}
+	retry := func(call *Call, next Invoker) error {
+		err := next(call)
+		if err != nil && call.Op == OpStart {
+			err = next(call)
+		}
+		return err
+	}
+
+	p := makeBinShParams()
+	p.Interceptors = []Interceptor{audit, allow, retry, flaky, shout}
+	sh := NewShell(p)
+	assert.NoError(t, sh.Start(timeOutShort))
+	assert.Equal(t, 2, starts)
+
+	rc := NewRecallCommander("echo hello")
+	assert.NoError(t, sh.Run(timeOutShort, rc))
+	assert.Equal(t, []string{"HELLO"}, rc.DataOut())
+
+	// A rejected command leaves the shell usable.
+	err := sh.Run(timeOutShort, NewRecallCommander("rm -rf /tmp/x"))
+	assert.ErrorIs(t, err, errNotAllowed)
+	rc = NewRecallCommander("pwd")
+	assert.NoError(t, sh.Run(timeOutShort, rc))
+	assert.Len(t, rc.DataOut(), 1)
+
+	assert.NoError(t, sh.Stop(timeOutShort, ""))
+	assert.Error(t, sh.Stop(timeOutShort, ""))
+	if assert.Len(t, log, 6) {
+		assert.Equal(t, "start; <nil>", log[0])
+		assert.Equal(t, "run echo hello | tr a-z A-Z; <nil>", log[1])
+		assert.Equal(t, "run rm -rf /tmp/x; not allowed", log[2])
+		assert.Equal(t, "run pwd; <nil>", log[3])
+		assert.Equal(t, "stop; <nil>", log[4])
+		assert.True(t, strings.HasPrefix(log[5], "stop; shexec infra"))
+	}
+}
@@ -0,0 +1,231 @@
+package shexec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// JSONFormat says how a JSONCommander decodes stdOut.
+type JSONFormat int
+
+const (
+	// JSONAuto treats output starting with '[' as a JSONArray,
+	// and anything else as a sequence of one or more JSON values,
+	// which covers both JSONDocument and JSONLines.
+	// Use JSONDocument if T is itself a slice.
+	JSONAuto JSONFormat = iota
+	// JSONDocument is a single JSON value.
+	JSONDocument
+	// JSONArray is a JSON array, each element of which is a value.
+	JSONArray
+	// JSONLines is one JSON value per line; blank lines are ignored.
+	JSONLines
+)
+
+// JSONCommander decodes the JSON emitted on stdOut by a command,
+// e.g. a CLI with an "--output json" flag, into values of type T.
+//
+// Decoding happens when the stdOut parser is closed.  Decoding errors
+// don't fail the call to Run; they're available from Err, along with
+// what was seen on stdErr if CaptureErr is true.
+// Each Run replaces the results of the previous one.
+type JSONCommander[T any] struct {
+	C      string
+	Format JSONFormat
+	// CaptureErr, if true, makes output on stdErr an error,
+	// available from Err as a *StdErrError.
+	CaptureErr bool
+
+	values    []T
+	decodeErr error
+	wErr      *LineAbsorber
+}
+
+// NewJSONCommander returns an instance of JSONCommander.
+func NewJSONCommander[T any](c string, f JSONFormat) *JSONCommander[T] {
+	return &JSONCommander[T]{C: c, Format: f}
+}
+
+func (c *JSONCommander[T]) Command() string { return c.C }
+
+func (c *JSONCommander[T]) ParseOut() io.WriteCloser {
+	c.values, c.decodeErr = nil, nil
+	return &lineBuffer{onClose: func(data []byte) {
+		c.values, c.decodeErr = decodeJSON[T](data, c.Format)
+	}}
+}
+
+func (c *JSONCommander[T]) ParseErr() io.WriteCloser {
+	c.wErr = &LineAbsorber{}
+	return c.wErr
+}
+
+// Values returns all the values decoded.
+func (c *JSONCommander[T]) Values() []T { return c.values }
+
+// Value returns the first value decoded, or T's zero value if
+// there were none.
+func (c *JSONCommander[T]) Value() (v T) {
+	if len(c.values) > 0 {
+		v = c.values[0]
+	}
+	return
+}
+
+// Result returns the values decoded, and the error from Err.
+func (c *JSONCommander[T]) Result() ([]T, error) {
+	return c.Values(), c.Err()
+}
+
+// Err returns the error encountered decoding stdOut, if any,
+// else the error made from stdErr if CaptureErr is true and the
+// command wrote to stdErr.
+func (c *JSONCommander[T]) Err() error {
+	if c.decodeErr != nil {
+		return c.decodeErr
+	}
+	if c.CaptureErr && c.wErr != nil && len(c.wErr.Lines()) > 0 {
+		return newStdErrError(c.C, c.wErr.Lines())
+	}
+	return nil
+}
+
+func decodeJSON[T any](data []byte, f JSONFormat) ([]T, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+	if f == JSONAuto && trimmed[0] == '[' {
+		f = JSONArray
+	}
+	switch f {
+	case JSONDocument:
+		var v T
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, newJSONDecodeError(data, 0, err)
+		}
+		return []T{v}, nil
+	case JSONArray:
+		var v []T
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, newJSONDecodeError(data, 0, err)
+		}
+		return v, nil
+	case JSONLines:
+		return decodeJSONLines[T](data)
+	default:
+		return decodeJSONStream[T](data)
+	}
+}
+
+func decodeJSONLines[T any](data []byte) (result []T, err error) {
+	for i, line := range bytes.Split(data, []byte{newLineChar}) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var v T
+		if err = json.Unmarshal(line, &v); err != nil {
+			return nil, &JSONDecodeError{
+				Line: i + 1, Text: string(line), Err: err}
+		}
+		result = append(result, v)
+	}
+	return
+}
+
+func decodeJSONStream[T any](data []byte) (result []T, err error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		start := dec.InputOffset()
+		var v T
+		err = dec.Decode(&v)
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		if err != nil {
+			return nil, newJSONDecodeError(data, start, err)
+		}
+		result = append(result, v)
+	}
+}
+
+// JSONDecodeError reports a failure to decode JSON, with
+// the line of output at which the failure happened.
+type JSONDecodeError struct {
+	// Line is the 1-relative line number, or zero if unknown.
+	Line int
+	// Text is the text of the line.
+	Text string
+	Err  error
+}
+
+func (e *JSONDecodeError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("json decode; %v", e.Err)
+	}
+	return fmt.Sprintf("json decode; line %d %q; %v", e.Line, e.Text, e.Err)
+}
+
+func (e *JSONDecodeError) Unwrap() error { return e.Err }
+
+// newJSONDecodeError makes a JSONDecodeError from an error
+// returned by encoding/json, where start is the offset in data
+// of the value being decoded.
+func newJSONDecodeError(data []byte, start int64, err error) error {
+	var (
+		off     int64 = -1
+		synErr  *json.SyntaxError
+		typeErr *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &synErr):
+		off = synErr.Offset
+	case errors.As(err, &typeErr):
+		off = start + typeErr.Offset
+	}
+	if off < 0 {
+		return &JSONDecodeError{Err: err}
+	}
+	// The offset is just past the offending byte.
+	off = min(max(off-1, 0), int64(len(data)))
+	lineStart := bytes.LastIndexByte(data[:off], newLineChar) + 1
+	text, _, _ := bytes.Cut(data[lineStart:], []byte{newLineChar})
+	return &JSONDecodeError{
+		Line: bytes.Count(data[:lineStart], []byte{newLineChar}) + 1,
+		Text: string(text),
+		Err:  err,
+	}
+}
+
+// StdErrError holds what a command wrote to stdErr.
+type StdErrError struct {
+	Command string
+	Lines   []string
+	// Fields holds the decoded stdErr output, if it was a JSON object.
+	Fields map[string]any
+}
+
+func newStdErrError(c string, lines []string) *StdErrError {
+	e := &StdErrError{Command: abbrev(c), Lines: lines}
+	var fields map[string]any
+	if json.Unmarshal(
+		[]byte(strings.Join(lines, "\n")), &fields) == nil {
+		e.Fields = fields
+	}
+	return e
+}
+
+func (e *StdErrError) Error() string {
+	msg := strings.Join(e.Lines, "; ")
+	for _, k := range []string{"message", "error", "msg"} {
+		if s, ok := e.Fields[k].(string); ok {
+			msg = s
+			break
+		}
+	}
+	return fmt.Sprintf("%q wrote to stdErr: %s", e.Command, msg)
+}
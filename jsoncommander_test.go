@@ -0,0 +1,109 @@
+package shexec_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/monopole/shexec"
+	"github.com/stretchr/testify/assert"
+)
+
+type bus struct {
+	ID    int    `json:"id"`
+	Route string `json:"route"`
+}
+
+func TestJSONCommander(t *testing.T) {
+	sh := NewShell(makeBinShParams())
+	assert.NoError(t, sh.Start(timeOutShort))
+	defer func() { assert.NoError(t, sh.Stop(timeOutShort, "")) }()
+
+	testCases := map[string]struct {
+		cmd      string
+		format   JSONFormat
+		expected []bus
+	}{
+		"document": {
+			cmd:      `echo '{"id": 1,'; echo ' "route": "a"}'`,
+			expected: []bus{{1, "a"}},
+		},
+		"array": {
+			cmd: `echo '[{"id": 1, "route": "a"},'; ` +
+				`echo ' {"id": 2, "route": "b"}]'`,
+			expected: []bus{{1, "a"}, {2, "b"}},
+		},
+		"lines": {
+			cmd: `echo '{"id": 1, "route": "a"}'; echo; ` +
+				`echo '{"id": 2, "route": "b"}'`,
+			format:   JSONLines,
+			expected: []bus{{1, "a"}, {2, "b"}},
+		},
+		"linesAuto": {
+			cmd: `echo '{"id": 1, "route": "a"}'; ` +
+				`echo '{"id": 2, "route": "b"}'`,
+			expected: []bus{{1, "a"}, {2, "b"}},
+		},
+		"empty": {
+			cmd: `true`,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			c := NewJSONCommander[bus](tc.cmd, tc.format)
+			assert.NoError(t, sh.Run(timeOutShort, c))
+			assert.NoError(t, c.Err())
+			assert.Equal(t, tc.expected, c.Values())
+		})
+	}
+
+	// A slice type needs JSONDocument.
+	cs := NewJSONCommander[[]int]("echo '[1, 2, 3]'", JSONDocument)
+	assert.NoError(t, sh.Run(timeOutShort, cs))
+	assert.Equal(t, []int{1, 2, 3}, cs.Value())
+}
+
+func TestJSONCommanderErrors(t *testing.T) {
+	sh := NewShell(makeBinShParams())
+	assert.NoError(t, sh.Start(timeOutShort))
+	defer func() { assert.NoError(t, sh.Stop(timeOutShort, "")) }()
+
+	c := NewJSONCommander[bus](
+		`echo '{"id": 1}'; echo '{"id": 2}'; echo '{"id": oops}'`, JSONAuto)
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	var de *JSONDecodeError
+	if assert.True(t, errors.As(c.Err(), &de)) {
+		assert.Equal(t, 3, de.Line)
+		assert.Equal(t, `{"id": oops}`, de.Text)
+	}
+
+	c = NewJSONCommander[bus](
+		`echo '[{"id": 1},'; echo ' {"id": "two"}]'`, JSONArray)
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	if assert.True(t, errors.As(c.Err(), &de)) {
+		assert.Equal(t, 2, de.Line)
+	}
+
+	c = NewJSONCommander[bus](`echo '{"id": 1}'; echo '{"id": x}'`, JSONLines)
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	if assert.True(t, errors.As(c.Err(), &de)) {
+		assert.Equal(t, 2, de.Line)
+	}
+
+	// A rerun replaces earlier results.
+	c.C = `echo '{"id": 1}'`
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	assert.NoError(t, c.Err())
+	assert.Len(t, c.Values(), 1)
+
+	// stdErr is only an error if asked.
+	c.C = `echo '{"message": "no such bus", "code": 4}' 1>&2`
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	assert.NoError(t, c.Err())
+	c.CaptureErr = true
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	var se *StdErrError
+	if assert.True(t, errors.As(c.Err(), &se)) {
+		assert.Equal(t, float64(4), se.Fields["code"])
+		assert.Contains(t, se.Error(), "no such bus")
+	}
+}
@@ -0,0 +1,199 @@
+package shexec
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/monopole/shexec/channeler"
+)
+
+// TruncationPolicy says what happens when a command's output
+// exceeds its OutputLimits.
+type TruncationPolicy int
+
+const (
+	// TruncateAndDrain stops forwarding output to the parser once a
+	// limit is hit, but keeps reading (and discarding) output up to
+	// the sentinel, leaving the shell ready for the next command.
+	TruncateAndDrain TruncationPolicy = iota
+
+	// TruncateAndInterrupt is like TruncateAndDrain, but also sends an
+	// interrupt signal to the shell once a limit is hit.  Shells that
+	// treat an interrupt as "cancel the current command" (e.g. python,
+	// psql, mysql) will skip to the sentinel.  Other shells may exit,
+	// in which case Run fails as it would for any crash.
+	TruncateAndInterrupt
+)
+
+// OutputLimits bounds the output forwarded to a Commander's parsers.
+// Limits apply to each stream separately.  A zero value means no limit.
+type OutputLimits struct {
+	// MaxLines is the most lines forwarded to a parser.
+	MaxLines int
+
+	// MaxBytes is the most bytes forwarded to a parser.
+	// Lines are never split; a line that would exceed the limit
+	// is dropped along with all lines after it.
+	MaxBytes int64
+
+	// Policy says what to do once a limit is hit.
+	Policy TruncationPolicy
+}
+
+// OutputLimiter is an optional Commander extension.
+// A Commander implementing it can tighten, but not loosen, the
+// limits set in Parameters.OutputLimits.
+type OutputLimiter interface {
+	OutputLimits() OutputLimits
+}
+
+// isZero is true if there are no limits.
+func (ol OutputLimits) isZero() bool {
+	return ol.MaxLines < 1 && ol.MaxBytes < 1
+}
+
+// tighten returns the stricter combination of two limits.
+func (ol OutputLimits) tighten(other OutputLimits) OutputLimits {
+	if other.MaxLines > 0 &&
+		(ol.MaxLines < 1 || other.MaxLines < ol.MaxLines) {
+		ol.MaxLines = other.MaxLines
+	}
+	if other.MaxBytes > 0 &&
+		(ol.MaxBytes < 1 || other.MaxBytes < ol.MaxBytes) {
+		ol.MaxBytes = other.MaxBytes
+	}
+	if other.Policy == TruncateAndInterrupt {
+		ol.Policy = TruncateAndInterrupt
+	}
+	return ol
+}
+
+// TruncationError is returned by Run when output was truncated.
+// Unlike other errors from Run, it doesn't mean the shell is dead;
+// the shell remains ready for another command.  If both streams were
+// truncated, Run returns a TruncationError for each, joined by
+// errors.Join, stdOut's first.
+type TruncationError struct {
+	// Command is the (abbreviated) command whose output was truncated.
+	Command string
+	// Stream is the stream on which truncation occurred.
+	Stream string
+	// Lines and Bytes count what was forwarded before truncation.
+	Lines int
+	Bytes int64
+	// Interrupted is true if the shell was sent an interrupt.
+	Interrupted bool
+}
+
+func (e *TruncationError) Error() string {
+	msg := fmt.Sprintf(
+		"%s; output of %q truncated on %s after %d lines (%d bytes)",
+		errCategory, e.Command, e.Stream, e.Lines, e.Bytes)
+	if e.Interrupted {
+		msg += "; shell interrupted"
+	}
+	return msg
+}
+
+// limitedParser forwards data to a parser until a limit is hit.
+// After that it discards data, reporting success so that
+// scanning continues to the sentinel.
+type limitedParser struct {
+	io.WriteCloser
+	name      string
+	limits    OutputLimits
+	lines     int
+	bytes     int64
+	truncated bool
+	// onTruncate is called once, when truncation begins.
+	onTruncate func()
+	// binary is true if the parser gets binary output.
+	binary bool
+}
+
+func (lp *limitedParser) Write(data []byte) (int, error) {
+	if lp.binary {
+		return len(data), lp.writeRaw(data)
+	}
+	return len(data), lp.WriteLine(channeler.Line{Text: data})
+}
+
+func (lp *limitedParser) WriteLine(line channeler.Line) error {
+	if lp.truncated {
+		return nil
+	}
+	if (lp.limits.MaxLines > 0 && lp.lines+1 > lp.limits.MaxLines) ||
+		(lp.limits.MaxBytes > 0 &&
+			lp.bytes+int64(len(line.Text)) > lp.limits.MaxBytes) {
+		lp.truncated = true
+		lp.onTruncate()
+		return nil
+	}
+	lp.lines++
+	lp.bytes += int64(len(line.Text))
+	return writeLine(lp.WriteCloser, line)
+}
+
+// limitParsers wraps the Commander's parsers to enforce output limits.
+// The returned function reports any truncation that occurred,
+// and should be called after both parsers are closed.
+func (eInf *execInfra) limitParsers(
+	c Commander) (io.WriteCloser, io.WriteCloser, func() error) {
+	pOut, pErr := eInf.parsers(c)
+	limits := eInf.limits
+	if ol, ok := extension[OutputLimiter](c); ok {
+		limits = limits.tighten(ol.OutputLimits())
+	}
+	if limits.isZero() {
+		return pOut, pErr, func() error { return nil }
+	}
+	var interrupted bool
+	onTruncate := func() {}
+	if limits.Policy == TruncateAndInterrupt {
+		var once sync.Once
+		onTruncate = func() {
+			once.Do(func() { interrupted = eInf.interrupt() })
+		}
+	}
+	out := &limitedParser{
+		WriteCloser: pOut, name: "stdOut",
+		limits: limits, onTruncate: onTruncate, binary: isBinary(c),
+	}
+	errP := &limitedParser{
+		WriteCloser: pErr, name: "stdErr",
+		limits: limits, onTruncate: onTruncate, binary: isBinary(c),
+	}
+	return out, errP, func() error {
+		var errs []error
+		for _, lp := range []*limitedParser{out, errP} {
+			if lp.truncated {
+				errs = append(errs, &TruncationError{
+					Command:     eInf.lgr.abbrev(c.Command()),
+					Stream:      lp.name,
+					Lines:       lp.lines,
+					Bytes:       lp.bytes,
+					Interrupted: interrupted,
+				})
+			}
+		}
+		//nolint:wrapcheck
+		return errors.Join(errs...)
+	}
+}
+
+// interrupt sends an interrupt to the shell, if possible,
+// returning true on success.
+func (eInf *execInfra) interrupt() bool {
+	if eInf.channels.Interrupt == nil {
+		eInf.lgr.Println("interrupt; channels don't support interruption")
+		return false
+	}
+	if err := eInf.channels.Interrupt(); err != nil {
+		eInf.lgr.Printf("interrupt; failed: %v", err)
+		return false
+	}
+	eInf.lgr.Println("interrupt; sent")
+	return true
+}
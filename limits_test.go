@@ -0,0 +1,141 @@
+package shexec_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/monopole/shexec"
+	"github.com/monopole/shexec/channeler"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeBinShParams() Parameters {
+	return Parameters{
+		Params: channeler.Params{Path: "/bin/sh"},
+		SentinelOut: Sentinel{
+			C: "echo " + unlikelyStdOut,
+			V: unlikelyStdOut,
+		},
+		SentinelErr: Sentinel{
+			C: "echo " + unlikelyStdErr + " 1>&2",
+			V: unlikelyStdErr,
+		},
+	}
+}
+
+// limitedCommander is a RecallCommander with its own limits.
+type limitedCommander struct {
+	*RecallCommander
+	limits OutputLimits
+}
+
+func (c *limitedCommander) OutputLimits() OutputLimits { return c.limits }
+
+func TestOutputLimitsShellLines(t *testing.T) {
+	p := makeBinShParams()
+	p.OutputLimits = OutputLimits{MaxLines: 3}
+	sh := NewShell(p)
+	assert.NoError(t, sh.Start(timeOutShort))
+
+	c := NewRecallCommander("seq 1 1000")
+	err := sh.Run(timeOutShort, c)
+	var te *TruncationError
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, "stdOut", te.Stream)
+		assert.Equal(t, 3, te.Lines)
+		assert.Equal(t, int64(3), te.Bytes)
+		assert.False(t, te.Interrupted)
+		assert.Contains(t, err.Error(),
+			`output of "seq 1 1000" truncated on stdOut after 3 lines`)
+	}
+	assert.Equal(t, []string{"1", "2", "3"}, c.DataOut())
+
+	// The shell survives truncation, and nothing leaks into the next run.
+	c = NewRecallCommander("echo hello")
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	assert.Equal(t, []string{"hello"}, c.DataOut())
+	assert.NoError(t, sh.Stop(timeOutShort, ""))
+}
+
+func TestOutputLimitsCommanderTightens(t *testing.T) {
+	p := makeBinShParams()
+	p.OutputLimits = OutputLimits{MaxLines: 100}
+	sh := NewShell(p)
+	assert.NoError(t, sh.Start(timeOutShort))
+
+	c := &limitedCommander{
+		RecallCommander: NewRecallCommander(
+			"echo alpha; echo beta 1>&2; echo gamma 1>&2"),
+		limits: OutputLimits{MaxBytes: 6},
+	}
+	err := sh.Run(timeOutShort, c)
+	var te *TruncationError
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, "stdErr", te.Stream)
+		assert.Equal(t, 1, te.Lines)
+		assert.Equal(t, int64(4), te.Bytes)
+	}
+	assert.Equal(t, []string{"alpha"}, c.DataOut())
+	assert.Equal(t, []string{"beta"}, c.DataErr())
+
+	// A commander can't loosen the shell's limits.
+	c.limits = OutputLimits{MaxLines: 1000}
+	c.Reset()
+	c.C = "seq 1 200"
+	err = sh.Run(timeOutShort, c)
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, 100, te.Lines)
+	}
+	assert.Len(t, c.DataOut(), 100)
+	assert.NoError(t, sh.Stop(timeOutShort, ""))
+}
+
+func TestOutputLimitsBothStreams(t *testing.T) {
+	p := makeBinShParams()
+	p.OutputLimits = OutputLimits{MaxLines: 2}
+	sh := NewShell(p)
+	assert.NoError(t, sh.Start(timeOutShort))
+
+	c := NewRecallCommander("seq 1 5; seq 1 4 1>&2")
+	err := sh.Run(timeOutShort, c)
+	var te *TruncationError
+	assert.True(t, errors.As(err, &te))
+	var joined interface{ Unwrap() []error }
+	if assert.True(t, errors.As(err, &joined)) {
+		errs := joined.Unwrap()
+		if assert.Len(t, errs, 2) {
+			assert.Contains(t, errs[0].Error(), "truncated on stdOut")
+			assert.Contains(t, errs[1].Error(), "truncated on stdErr")
+		}
+	}
+	assert.Equal(t, []string{"1", "2"}, c.DataOut())
+	assert.Equal(t, []string{"1", "2"}, c.DataErr())
+
+	// The shell survives.
+	assert.NoError(t, sh.Run(timeOutShort, NewRecallCommander("echo ok")))
+	assert.NoError(t, sh.Stop(timeOutShort, ""))
+}
+
+func TestOutputLimitsInterrupt(t *testing.T) {
+	p := makeBinShParams()
+	p.OutputLimits = OutputLimits{
+		MaxLines: 5,
+		Policy:   TruncateAndInterrupt,
+	}
+	sh := NewShell(p)
+	assert.NoError(t, sh.Start(timeOutShort))
+	// Keep the shell alive through the interrupt.
+	assert.NoError(t, sh.Run(timeOutShort,
+		&DiscardCommander{C: "trap 'echo caught 1>&2' INT"}))
+
+	c := NewRecallCommander("seq 1 10000")
+	err := sh.Run(timeOutLong, c)
+	var te *TruncationError
+	if assert.True(t, errors.As(err, &te)) {
+		assert.True(t, te.Interrupted)
+		assert.Contains(t, err.Error(), "shell interrupted")
+	}
+	assert.Len(t, c.DataOut(), 5)
+	assert.NoError(t, sh.Run(timeOutShort, NewRecallCommander("echo ok")))
+	assert.NoError(t, sh.Stop(timeOutShort, ""))
+}
@@ -0,0 +1,87 @@
+package shexec_test
+
+import (
+	"io"
+	"testing"
+
+	. "github.com/monopole/shexec"
+	"github.com/monopole/shexec/channeler"
+	"github.com/stretchr/testify/assert"
+)
+
+// lineCommander records the lines, with metadata, from both streams.
+type lineCommander struct {
+	cmd      string
+	out, err LineRecorder
+}
+
+func (c *lineCommander) Command() string          { return c.cmd }
+func (c *lineCommander) ParseOut() io.WriteCloser { return &c.out }
+func (c *lineCommander) ParseErr() io.WriteCloser { return &c.err }
+
+func TestLineMetadata(t *testing.T) {
+	sh := NewShell(makeBinShParams())
+	assert.NoError(t, sh.Start(timeOutShort))
+	c := &lineCommander{
+		cmd: "echo a; sleep 0.05; echo b 1>&2; sleep 0.05; echo c"}
+	assert.NoError(t, sh.Run(timeOutLong, c))
+
+	out, errs := c.out.Lines(), c.err.Lines()
+	if assert.Len(t, out, 2) && assert.Len(t, errs, 1) {
+		a, b, cc := out[0], errs[0], out[1]
+		assert.Equal(t, "a", string(a.Text))
+		assert.Equal(t, "b", string(b.Text))
+		assert.Equal(t, "c", string(cc.Text))
+		assert.Equal(t, channeler.StreamOut, a.Stream)
+		assert.Equal(t, channeler.StreamErr, b.Stream)
+		assert.Equal(t, channeler.StreamOut, cc.Stream)
+		assert.Less(t, a.Seq, b.Seq)
+		assert.Less(t, b.Seq, cc.Seq)
+		assert.True(t, a.Time.Before(b.Time))
+		assert.True(t, b.Time.Before(cc.Time))
+	}
+
+	// Sequence numbers keep increasing across runs.
+	last := out[len(out)-1].Seq
+	c.out.Reset()
+	c.err.Reset()
+	c.cmd = "echo d"
+	assert.NoError(t, sh.Run(timeOutLong, c))
+	if assert.Len(t, c.out.Lines(), 1) {
+		assert.Greater(t, c.out.Lines()[0].Seq, last)
+	}
+	assert.NoError(t, sh.Stop(timeOutShort, ""))
+}
+
+// mergedCommander records the lines of both streams in one list.
+type mergedCommander struct {
+	DiscardCommander
+	merged LineRecorder
+}
+
+func (c *mergedCommander) ParseMerged() MergedParser { return &c.merged }
+
+func TestMergedParsing(t *testing.T) {
+	sh := NewShell(makeBinShParams())
+	assert.NoError(t, sh.Start(timeOutShort))
+	for range 2 {
+		c := &mergedCommander{DiscardCommander: DiscardCommander{C: `
+for i in 1 2 3; do
+  echo row$i; sleep 0.02
+  echo "Error: #66$i" 1>&2; sleep 0.02
+done
+echo done`}}
+		assert.NoError(t, sh.Run(timeOutLong, c))
+		var got []string
+		for _, l := range c.merged.Lines() {
+			got = append(got, l.Stream.String()+" "+string(l.Text))
+		}
+		assert.Equal(t, []string{
+			"stdOut row1", "stdErr Error: #661",
+			"stdOut row2", "stdErr Error: #662",
+			"stdOut row3", "stdErr Error: #663",
+			"stdOut done",
+		}, got)
+	}
+	assert.NoError(t, sh.Stop(timeOutShort, ""))
+}
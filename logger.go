@@ -8,10 +8,32 @@ import (
 	"github.com/monopole/shexec/channeler"
 )
 
-// verboseLoggingEnabled can be set to true to see detailed logging.
-// nolint:gochecknoglobals
-var verboseLoggingEnabled = true
+// shLogger logs the workings of one Shell,
+// hiding the secrets of its Redactor.
+type shLogger struct {
+	*log.Logger
+	sink *logSink
+}
+
+func newLogger(detailed bool, r *channeler.Redactor) *shLogger {
+	sink := &logSink{detailed: detailed, r: r}
+	return &shLogger{
+		Logger: log.New(sink, "SHELL: ", log.Ldate|log.Ltime|log.Lshortfile),
+		sink:   sink,
+	}
+}
+
+// enabled is true if logging is.
+func (l *shLogger) enabled() bool {
+	return l.sink.detailed
+}
+
+// abbrev redacts, then abbreviates, the string.
+func (l *shLogger) abbrev(x string) string {
+	return abbrev(l.sink.r.Redact(x))
+}
 
+// abbrev abbreviates the string.
 func abbrev(x string) string {
 	if len(x) > channeler.AbbrevMaxLen {
 		return x[0:channeler.AbbrevMaxLen-1] + "..."
@@ -19,15 +41,15 @@ func abbrev(x string) string {
 	return x
 }
 
-type logSink struct{}
+type logSink struct {
+	detailed bool
+	r        *channeler.Redactor
+}
 
-func (l logSink) Write(p []byte) (n int, err error) {
-	if verboseLoggingEnabled {
+func (l *logSink) Write(p []byte) (n int, err error) {
+	if l.detailed {
 		//nolint:wrapcheck
-		return fmt.Fprint(os.Stderr, string(p))
+		return fmt.Fprint(os.Stderr, l.r.Redact(string(p)))
 	}
 	return 0, nil
 }
-
-// nolint:gochecknoglobals
-var lgr = log.New(&logSink{}, "SHELL: ", log.Ldate|log.Ltime|log.Lshortfile)
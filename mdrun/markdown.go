@@ -0,0 +1,243 @@
+// Package mdrun runs the command blocks found in markdown documents,
+// and checks their output against the expected output written
+// alongside them.
+package mdrun
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// DefaultLabel marks a fenced block holding commands, e.g.
+	//
+	//	```sh shexec
+	DefaultLabel = "shexec"
+	// DefaultOutputLabel marks a fenced block holding the expected
+	// output of the command block just before it, e.g.
+	//
+	//	```text output
+	DefaultOutputLabel = "output"
+)
+
+// Block is a fenced code block in a markdown document.
+type Block struct {
+	// Line is the 1-relative line number of the opening fence.
+	Line int
+	// Info is the text following the opening fence.
+	Info string
+	// Text is the block's content, without the fences.
+	Text string
+	// Expected is the block holding the expected output, if any.
+	Expected *Block
+	// first and last are 0-relative line indices of the content,
+	// last being exclusive.
+	first, last int
+	indent      int
+}
+
+// hasLabel is true if the block's info string has the label as a word.
+func (b *Block) hasLabel(label string) bool {
+	for _, w := range strings.Fields(b.Info) {
+		if strings.Trim(w, "{}") == label {
+			return true
+		}
+	}
+	return false
+}
+
+// Doc is a markdown document.
+type Doc struct {
+	Name        string
+	lines       []string
+	outputLabel string
+	// Blocks holds the command blocks, in order.
+	Blocks []*Block
+}
+
+// Parse finds the command blocks, and their expected output blocks,
+// in a markdown document.  An expected output block must follow its
+// command block with nothing but blank lines between them.
+func Parse(name string, data []byte, label, outputLabel string) (*Doc, error) {
+	d := &Doc{
+		Name:        name,
+		lines:       strings.Split(string(data), "\n"),
+		outputLabel: outputLabel,
+	}
+	all, err := d.fencedBlocks()
+	if err != nil {
+		return nil, err
+	}
+	for i, b := range all {
+		if !b.hasLabel(label) {
+			continue
+		}
+		d.Blocks = append(d.Blocks, b)
+		if i+1 < len(all) && all[i+1].hasLabel(outputLabel) &&
+			d.blankBetween(b.last+1, all[i+1].Line-1) {
+			b.Expected = all[i+1]
+		}
+	}
+	return d, nil
+}
+
+// fencedBlocks returns all the fenced blocks in the document.
+func (d *Doc) fencedBlocks() (blocks []*Block, err error) {
+	for i := 0; i < len(d.lines); i++ {
+		indent, fence, info, ok := openingFence(d.lines[i])
+		if !ok {
+			continue
+		}
+		b := &Block{Line: i + 1, Info: info, first: i + 1, indent: indent}
+		i = b.first
+		for i < len(d.lines) && !isClosingFence(d.lines[i], fence) {
+			i++
+		}
+		if i == len(d.lines) {
+			return nil, fmt.Errorf( //nolint:goerr113
+				"%s:%d: unterminated code block", d.Name, b.Line)
+		}
+		b.last = i
+		b.Text = d.content(b)
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// content returns the block's lines, less the fence's indentation.
+func (d *Doc) content(b *Block) string {
+	lines := make([]string, 0, b.last-b.first)
+	for _, l := range d.lines[b.first:b.last] {
+		n := 0
+		for n < b.indent && n < len(l) && l[n] == ' ' {
+			n++
+		}
+		lines = append(lines, l[n:])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// blankBetween is true if lines [from, to) are blank.
+func (d *Doc) blankBetween(from, to int) bool {
+	for _, l := range d.lines[from:to] {
+		if strings.TrimSpace(l) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// openingFence recognizes a line opening a fenced code block.
+func openingFence(line string) (indent int, fence, info string, ok bool) {
+	for indent < len(line) && indent < 4 && line[indent] == ' ' {
+		indent++
+	}
+	if indent > 3 {
+		return 0, "", "", false
+	}
+	rest := line[indent:]
+	for _, c := range []string{"`", "~"} {
+		n := len(rest) - len(strings.TrimLeft(rest, c))
+		if n < 3 {
+			continue
+		}
+		info = strings.TrimSpace(rest[n:])
+		if c == "`" && strings.Contains(info, "`") {
+			return 0, "", "", false
+		}
+		return indent, rest[:n], info, true
+	}
+	return 0, "", "", false
+}
+
+// isClosingFence is true if the line closes a block opened by fence.
+func isClosingFence(line, fence string) bool {
+	t := strings.TrimSpace(line)
+	return len(line)-len(strings.TrimLeft(line, " ")) < 4 &&
+		len(t) >= len(fence) && strings.Trim(t, fence[:1]) == ""
+}
+
+// Rewrite returns the document with the content of each expected
+// output block replaced by the actual output in the results.
+// A command block lacking an expected output block gets a new one,
+// just after it, if it wrote any output.
+// Blocks that failed to run are left alone.
+func (d *Doc) Rewrite(results []*Result) []byte {
+	var out []string
+	next := 0
+	for _, r := range results {
+		if r.Err != nil {
+			continue
+		}
+		e := r.Block.Expected
+		if e == nil {
+			if r.Actual == "" {
+				continue
+			}
+			b := r.Block
+			out = append(out, d.lines[next:b.last+1]...)
+			out = append(out, d.outputBlock(b.indent, r.Actual)...)
+			next = b.last + 1
+			continue
+		}
+		out = append(out, d.lines[next:e.first-1]...)
+		out = append(out, d.replacedBlock(e, r.Actual)...)
+		next = e.last + 1
+	}
+	out = append(out, d.lines[next:]...)
+	return []byte(strings.Join(out, "\n"))
+}
+
+// outputBlock returns the lines of a new expected output block,
+// preceded by a blank line, holding the text.
+func (d *Doc) outputBlock(indent int, text string) []string {
+	pad := strings.Repeat(" ", indent)
+	fence := fenceFor(text, '`')
+	lines := []string{"", pad + fence + "text " + d.outputLabel}
+	lines = append(lines, padLines(indent, text)...)
+	return append(lines, pad+fence)
+}
+
+// replacedBlock returns the lines of the expected output block, fences
+// included, with its content replaced by the text.  The fences are
+// lengthened if the text could otherwise close the block.
+func (d *Doc) replacedBlock(e *Block, text string) []string {
+	opening, closing := d.lines[e.first-1], d.lines[e.last]
+	indent, fence, _, _ := openingFence(opening)
+	longer := fenceFor(text, fence[0])
+	if len(longer) <= len(fence) {
+		longer = fence
+	}
+	lines := []string{opening[:indent] + longer + opening[indent+len(fence):]}
+	lines = append(lines, padLines(e.indent, text)...)
+	n := len(closing) - len(strings.TrimLeft(closing, " "))
+	return append(lines,
+		closing[:n]+longer+strings.TrimLeft(closing[n:], fence[:1]))
+}
+
+// fenceFor returns a fence of the character c longer than any run of
+// c starting a line of the text, so that the text can't close it.
+func fenceFor(text string, c byte) string {
+	n := 3
+	for _, l := range strings.Split(text, "\n") {
+		l = strings.TrimLeft(l, " ")
+		if k := len(l) - len(strings.TrimLeft(l, string(c))); k >= n {
+			n = k + 1
+		}
+	}
+	return strings.Repeat(string(c), n)
+}
+
+// padLines splits the text into lines indented by indent spaces.
+// Empty text has no lines.
+func padLines(indent int, text string) []string {
+	if text == "" {
+		return nil
+	}
+	pad := strings.Repeat(" ", indent)
+	lines := strings.Split(text, "\n")
+	for i, l := range lines {
+		lines[i] = pad + l
+	}
+	return lines
+}
@@ -0,0 +1,161 @@
+package mdrun_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/monopole/shexec"
+	. "github.com/monopole/shexec/mdrun"
+	"github.com/stretchr/testify/assert"
+)
+
+const timeOut = 2 * time.Second
+
+const doc = "# Demo\n" +
+	"\n" +
+	"Set a variable.\n" +
+	"\n" +
+	"```sh shexec\n" +
+	"greeting=hello\n" +
+	"```\n" +
+	"\n" +
+	"Use it; state carries over.\n" +
+	"\n" +
+	"```sh shexec\n" +
+	"echo $greeting; sleep 0.05\n" +
+	"echo oops 1>&2\n" +
+	"```\n" +
+	"\n" +
+	"```text output\n" +
+	"hello\n" +
+	"oops\n" +
+	"```\n" +
+	"\n" +
+	"Not a command block:\n" +
+	"\n" +
+	"```sh\n" +
+	"rm -rf /\n" +
+	"```\n" +
+	"\n" +
+	"  ~~~~ {shexec}\n" +
+	"  printf 'a\\nb\\n'\n" +
+	"  ~~~~\n" +
+	"  ```output\n" +
+	"  wrong\n" +
+	"  ```\n"
+
+func startShell(t *testing.T) shexec.Shell {
+	sh := shexec.NewShell(ShellParameters("/bin/sh"))
+	assert.NoError(t, sh.Start(timeOut))
+	return sh
+}
+
+func TestParse(t *testing.T) {
+	d, err := Parse("demo.md", []byte(doc), DefaultLabel, DefaultOutputLabel)
+	assert.NoError(t, err)
+	if assert.Len(t, d.Blocks, 3) {
+		assert.Equal(t, 5, d.Blocks[0].Line)
+		assert.Nil(t, d.Blocks[0].Expected)
+		assert.Equal(t,
+			"echo $greeting; sleep 0.05\necho oops 1>&2", d.Blocks[1].Text)
+		assert.Equal(t, "hello\noops", d.Blocks[1].Expected.Text)
+		assert.Equal(t, "{shexec}", d.Blocks[2].Info)
+		assert.Equal(t, "printf 'a\\nb\\n'", d.Blocks[2].Text)
+		assert.Equal(t, "wrong", d.Blocks[2].Expected.Text)
+	}
+
+	_, err = Parse("bad.md", []byte("x\n```shexec\necho\n"),
+		DefaultLabel, DefaultOutputLabel)
+	assert.EqualError(t, err, "bad.md:2: unterminated code block")
+}
+
+func TestRunAndRewrite(t *testing.T) {
+	d, err := Parse("demo.md", []byte(doc), DefaultLabel, DefaultOutputLabel)
+	assert.NoError(t, err)
+	sh := startShell(t)
+	results := d.Run(sh, timeOut)
+	assert.NoError(t, sh.Stop(timeOut, ""))
+	if assert.Len(t, results, 3) {
+		assert.True(t, results[0].Matches())
+		assert.True(t, results[1].Matches())
+		assert.False(t, results[2].Matches())
+		assert.Equal(t, "a\nb", results[2].Actual)
+	}
+
+	rewritten := d.Rewrite(results)
+	assert.Equal(t, doc[:len(doc)-len("  wrong\n  ```\n")]+
+		"  a\n  b\n  ```\n", string(rewritten))
+
+	// A rewritten document passes.
+	d, err = Parse("demo.md", rewritten, DefaultLabel, DefaultOutputLabel)
+	assert.NoError(t, err)
+	sh = startShell(t)
+	for _, r := range d.Run(sh, timeOut) {
+		assert.True(t, r.Matches())
+	}
+	assert.NoError(t, sh.Stop(timeOut, ""))
+}
+
+func TestRewriteAddsMissingOutput(t *testing.T) {
+	const in = "```sh shexec\ncd /tmp\n```\n" +
+		"Text.\n" +
+		"  ```shexec\n  printf '```\\nx\\n'\n  ```\n" +
+		"Done.\n"
+	d, err := Parse("add.md", []byte(in), DefaultLabel, DefaultOutputLabel)
+	assert.NoError(t, err)
+	sh := startShell(t)
+	results := d.Run(sh, timeOut)
+	assert.NoError(t, sh.Stop(timeOut, ""))
+	rewritten := d.Rewrite(results)
+	assert.Equal(t, "```sh shexec\ncd /tmp\n```\n"+
+		"Text.\n"+
+		"  ```shexec\n  printf '```\\nx\\n'\n  ```\n"+
+		"\n  ````text output\n  ```\n  x\n  ````\n"+
+		"Done.\n", string(rewritten))
+
+	// The added block is found, and matches.
+	d, err = Parse("add.md", rewritten, DefaultLabel, DefaultOutputLabel)
+	assert.NoError(t, err)
+	if assert.Len(t, d.Blocks, 2) && assert.NotNil(t, d.Blocks[1].Expected) {
+		assert.Equal(t, "```\nx", d.Blocks[1].Expected.Text)
+	}
+}
+
+func TestRewriteLengthensFence(t *testing.T) {
+	const in = "```shexec\nprintf '````\\nx\\n'\n```\n" +
+		"\n```text output\nold\n```\n" +
+		"\n  ~~~shexec\n  printf '~~~\\n'\n  ~~~\n" +
+		"  ~~~output\n  ~~~\n"
+	d, err := Parse("fence.md", []byte(in), DefaultLabel, DefaultOutputLabel)
+	assert.NoError(t, err)
+	sh := startShell(t)
+	results := d.Run(sh, timeOut)
+	assert.NoError(t, sh.Stop(timeOut, ""))
+	rewritten := d.Rewrite(results)
+	assert.Equal(t, "```shexec\nprintf '````\\nx\\n'\n```\n"+
+		"\n`````text output\n````\nx\n`````\n"+
+		"\n  ~~~shexec\n  printf '~~~\\n'\n  ~~~\n"+
+		"  ~~~~output\n  ~~~\n  ~~~~\n", string(rewritten))
+
+	// The output no longer closes the block early, so it matches.
+	d, err = Parse("fence.md", rewritten, DefaultLabel, DefaultOutputLabel)
+	assert.NoError(t, err)
+	sh = startShell(t)
+	for _, r := range d.Run(sh, timeOut) {
+		assert.True(t, r.Matches())
+	}
+	assert.NoError(t, sh.Stop(timeOut, ""))
+}
+
+func TestRunStopsOnFailure(t *testing.T) {
+	d, err := Parse("fail.md", []byte(
+		"```shexec\nexit 3\n```\n```shexec\necho never\n```\n"),
+		DefaultLabel, DefaultOutputLabel)
+	assert.NoError(t, err)
+	sh := startShell(t)
+	results := d.Run(sh, timeOut)
+	if assert.Len(t, results, 1) {
+		assert.Error(t, results[0].Err)
+		assert.False(t, results[0].Matches())
+	}
+}
@@ -0,0 +1,69 @@
+package mdrun
+
+import (
+	"strings"
+	"time"
+
+	"github.com/monopole/shexec"
+	"github.com/monopole/shexec/channeler"
+)
+
+// sentinelTag makes the sentinel values.
+const sentinelTag = "mdrun_3c1e0f"
+
+// ShellParameters returns Parameters for running command blocks
+// with the given POSIX shell, e.g. "/bin/sh" or "bash".
+func ShellParameters(path string, args ...string) shexec.Parameters {
+	return shexec.NewEchoParameters(sentinelTag, path, args...)
+}
+
+// Result is the outcome of running a command block.
+type Result struct {
+	Block *Block
+	// Actual is the output of the block, stdOut and stdErr merged.
+	// Lines written to stdOut and stdErr at nearly the same moment
+	// may appear in either order.
+	Actual string
+	// Err is the error, if any, from running the block.
+	Err error
+}
+
+// Matches is true if the block ran, and either has no expected
+// output, or its expected output matches the actual output.
+func (r *Result) Matches() bool {
+	return r.Err == nil &&
+		(r.Block.Expected == nil || r.Block.Expected.Text == r.Actual)
+}
+
+// Run runs each of the document's command blocks, in order, as a
+// single command block on the shell, which must be started.
+// Running stops at the first block that fails to run, since the
+// shell is then unusable.
+func (d *Doc) Run(sh shexec.Shell, timeout time.Duration) []*Result {
+	results := make([]*Result, 0, len(d.Blocks))
+	for _, b := range d.Blocks {
+		c := &blockCommander{
+			DiscardCommander: shexec.DiscardCommander{C: b.Text}}
+		err := sh.Run(timeout, c)
+		results = append(results, &Result{
+			Block: b, Actual: strings.Join(c.lines, "\n"), Err: err})
+		if err != nil {
+			break
+		}
+	}
+	return results
+}
+
+// blockCommander collects the output of a command block,
+// stdOut and stdErr merged.
+type blockCommander struct {
+	shexec.DiscardCommander
+	lines []string
+}
+
+func (c *blockCommander) ParseMerged() shexec.MergedParser { return c }
+func (c *blockCommander) Close() error                     { return nil }
+func (c *blockCommander) WriteLine(l channeler.Line) error {
+	c.lines = append(c.lines, string(l.Text))
+	return nil
+}
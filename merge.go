@@ -0,0 +1,163 @@
+package shexec
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/monopole/shexec/channeler"
+)
+
+// MergedParser accepts the lines of both stdOut and stdErr, in one
+// stream, in the order in which the lines arrived.  Each line's Stream
+// field says where it came from.
+type MergedParser interface {
+	LineWriter
+	io.Closer
+}
+
+// Merger is an optional extension of Commander.  If a Commander
+// implements it, ParseMerged is called instead of ParseOut and ParseErr.
+//
+// The order is the order in which lines were read from the shell's
+// pipes, which is the best available; a line written to stdErr just
+// after a line written to stdOut is usually, but not necessarily, read
+// after it.  The MergedParser is closed only after both sentinels are
+// found.
+type Merger interface {
+	ParseMerged() MergedParser
+}
+
+const (
+	sideOut = iota
+	sideErr
+)
+
+// merger feeds a MergedParser from two parsers, one per stream.
+// Each stream's lines arrive in sequence order, so the merger holds
+// a line back only until it's sure no line from the other stream
+// precedes it.
+type merger struct {
+	mu      sync.Mutex
+	parser  MergedParser
+	pending [2][]channeler.Line
+	open    [2]bool
+	// next is the sequence number expected next; a line
+	// bearing it can be forwarded immediately.
+	next uint64
+	err  error
+}
+
+// mergeParsers returns parsers for stdOut and stdErr that feed the
+// Commander's MergedParser.  Lines with sequence numbers greater
+// than lastSeq are expected.
+func mergeParsers(
+	m Merger, lastSeq uint64, haveErr bool) (io.WriteCloser, io.WriteCloser) {
+	mg := &merger{parser: m.ParseMerged(), next: lastSeq + 1}
+	mg.open = [2]bool{true, haveErr}
+	return &mergeSide{mg, sideOut}, &mergeSide{mg, sideErr}
+}
+
+func (mg *merger) writeLine(side int, line channeler.Line) error {
+	mg.mu.Lock()
+	defer mg.mu.Unlock()
+	if line.Stream == channeler.StreamUnknown {
+		line.Stream = sideStream(side)
+	}
+	mg.pending[side] = append(mg.pending[side], line)
+	mg.flush()
+	if q := mg.pending[side]; len(q) > 0 {
+		// The line is held back; its text won't survive the next read.
+		q[len(q)-1].Text = bytes.Clone(line.Text)
+	}
+	return mg.err
+}
+
+func (mg *merger) close(side int) error {
+	mg.mu.Lock()
+	defer mg.mu.Unlock()
+	mg.open[side] = false
+	mg.flush()
+	if mg.open[sideOut] || mg.open[sideErr] {
+		return nil
+	}
+	if mg.err != nil {
+		return mg.err
+	}
+	//nolint:wrapcheck
+	return mg.parser.Close()
+}
+
+// flush forwards all the pending lines known to be in order.
+func (mg *merger) flush() {
+	for {
+		side := mg.ready()
+		if side < 0 {
+			return
+		}
+		line := mg.pending[side][0]
+		mg.pending[side] = mg.pending[side][1:]
+		if line.Seq > 0 {
+			mg.next = line.Seq + 1
+		}
+		if mg.err == nil {
+			mg.err = mg.parser.WriteLine(line)
+		}
+	}
+}
+
+// ready returns the side holding the next line to forward, or -1
+// if the next line cannot yet be known.
+func (mg *merger) ready() int {
+	qOut, qErr := mg.pending[sideOut], mg.pending[sideErr]
+	switch {
+	case len(qOut) > 0 && len(qErr) > 0:
+		if qErr[0].Seq < qOut[0].Seq {
+			return sideErr
+		}
+		return sideOut
+	case len(qOut) > 0:
+		if !mg.open[sideErr] || qOut[0].Seq == mg.next {
+			return sideOut
+		}
+	case len(qErr) > 0:
+		if !mg.open[sideOut] || qErr[0].Seq == mg.next {
+			return sideErr
+		}
+	}
+	return -1
+}
+
+func sideStream(side int) channeler.Stream {
+	if side == sideErr {
+		return channeler.StreamErr
+	}
+	return channeler.StreamOut
+}
+
+// mergeSide is the parser for one stream's contribution to a merger.
+type mergeSide struct {
+	mg   *merger
+	side int
+}
+
+func (ms *mergeSide) Write(data []byte) (int, error) {
+	return len(data), ms.WriteLine(channeler.Line{Text: data})
+}
+
+func (ms *mergeSide) WriteLine(line channeler.Line) error {
+	return ms.mg.writeLine(ms.side, line)
+}
+
+func (ms *mergeSide) Close() error { return ms.mg.close(ms.side) }
+
+// parsers returns the Commander's parsers for stdOut and stdErr.
+func (eInf *execInfra) parsers(c Commander) (io.WriteCloser, io.WriteCloser) {
+	m, ok := extension[Merger](c)
+	if !ok {
+		return c.ParseOut(), c.ParseErr()
+	}
+	return mergeParsers(
+		m, max(eInf.cursorOut.lastSeq, eInf.cursorErr.lastSeq),
+		eInf.scansErr())
+}
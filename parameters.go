@@ -16,6 +16,9 @@ type Parameters struct {
 	// SentinelOut is used to be sure that output generated in the
 	// course of running command N is swept up and accounted for
 	// before looking for output from command N+1.
+	// The sentinels aren't used, and needn't be set, if ControlFD
+	// is true; the shell then reports each command's completion on
+	// file descriptor 3, so it must understand "printf ... >&3".
 	SentinelOut Sentinel
 
 	// SentinelErr is a command that intentionally triggers output
@@ -28,16 +31,49 @@ type Parameters struct {
 	// looking for errors from command N+1.
 	SentinelErr Sentinel
 
+	// OutputLimits bounds the output forwarded to the parsers of
+	// every Commander run by the Shell.
+	OutputLimits OutputLimits
+
+	// Interceptors wrap every call to the Shell's Start, Run and Stop,
+	// the first of them outermost; see Interceptor.
+	Interceptors []Interceptor
+
+	// Policy, if not nil, decides which commands Run may send
+	// to the shell; see Policy.
+	Policy *Policy
+
 	// EnableDetailedLogging does what it sounds like
 	EnableDetailedLogging bool
 }
 
+// NewEchoParameters returns Parameters for the POSIX shell at path,
+// run with args, whose sentinels echo values made from the tag, i.e.
+// "<tag>_out" to stdOut and "<tag>_err" to stdErr.  The tag should be
+// unlikely to appear in output, e.g. "mytool_3c1e0f".
+func NewEchoParameters(tag, path string, args ...string) Parameters {
+	out, err := tag+"_out", tag+"_err"
+	return Parameters{
+		Params:      channeler.Params{Path: path, Args: args},
+		SentinelOut: Sentinel{C: "echo " + out, V: out},
+		SentinelErr: Sentinel{C: "echo " + err + " 1>&2", V: err},
+	}
+}
+
 // Validate returns an error if there's a problem in the Parameters.
 func (p *Parameters) Validate() error {
 	if err := p.Params.Validate(); err != nil {
 		//nolint:wrapcheck
 		return err
 	}
+	if p.Policy != nil {
+		if err := p.Policy.Validate(); err != nil {
+			return fmt.Errorf("problem in Policy; %w", err)
+		}
+	}
+	if p.ControlFD {
+		return nil
+	}
 	if err := p.SentinelOut.Validate(); err != nil {
 		return fmt.Errorf("problem in SentinelOut; %w", err)
 	}
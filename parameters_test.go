@@ -38,3 +38,17 @@ func TestParameters_Validate(t *testing.T) {
 	err = p.Validate()
 	assert.NoError(t, err)
 }
+
+func TestNewEchoParameters(t *testing.T) {
+	p := NewEchoParameters("test_8a7f2c", "/bin/sh", "-e")
+	assert.NoError(t, p.Validate())
+	assert.Equal(t, []string{"-e"}, p.Args)
+	sh := NewShell(p)
+	assert.NoError(t, sh.Start(timeOutShort))
+	// Empty lines are kept.
+	c := NewRecordCommander("echo a; echo; echo b 1>&2")
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	assert.Equal(t, []string{"a", ""}, c.DataOut())
+	assert.Equal(t, []string{"b"}, c.DataErr())
+	assert.NoError(t, sh.Stop(timeOutShort, ""))
+}
@@ -0,0 +1,63 @@
+package shexec
+
+import (
+	"errors"
+	"time"
+
+	"github.com/monopole/shexec/channeler"
+)
+
+// Parser is a Commander that yields a typed result.
+type Parser[T any] interface {
+	Commander
+	// Result returns what was parsed from the command's output,
+	// and any error found in that output.
+	Result() (T, error)
+}
+
+// RunT runs the Parser on the Shell and returns its result.
+// Options are handled as by RunWith.
+//
+// If Run fails, the error is returned with T's zero value, unless
+// it's a *TruncationError; then the result of parsing the truncated
+// output is returned too, with both errors joined.
+func RunT[T any](
+	sh Shell, d time.Duration, p Parser[T], opts ...RunOption) (T, error) {
+	err := RunWith(sh, d, p, opts...)
+	var te *TruncationError
+	if err != nil && !errors.As(err, &te) {
+		var zero T
+		return zero, err
+	}
+	v, pErr := p.Result()
+	return v, errors.Join(err, pErr)
+}
+
+// AsParser adapts a Commander to a Parser, using the given
+// function to get the Commander's result.  The Parser wraps the
+// Commander (see Unwrapper), so the Commander's extensions apply.
+func AsParser[T any](c Commander, f func() (T, error)) Parser[T] {
+	return &funcParser[T]{Commander: c, f: f}
+}
+
+type funcParser[T any] struct {
+	Commander
+	f func() (T, error)
+	// red hides secrets in the result's error.
+	red *channeler.Redactor
+}
+
+func (fp *funcParser[T]) Result() (T, error) {
+	v, err := fp.f()
+	return v, fp.red.RedactError(err)
+}
+
+func (fp *funcParser[T]) Unwrap() Commander { return fp.Commander }
+
+func (fp *funcParser[T]) redactWith(r *channeler.Redactor) { fp.red = r }
+
+// resultRedactable is a Parser whose Result is made after Run returns,
+// so must be given the Redactor hiding the secrets in its errors.
+type resultRedactable interface {
+	redactWith(r *channeler.Redactor)
+}
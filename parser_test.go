@@ -0,0 +1,82 @@
+package shexec_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	. "github.com/monopole/shexec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunT(t *testing.T) {
+	sh := NewShell(makeBinShParams())
+	assert.NoError(t, sh.Start(timeOutShort))
+	// The shell is ended below, but not if a check fails first.
+	defer func() { _ = sh.Stop(timeOutShort, "") }()
+
+	lines, err := RunT[[]string](
+		sh, timeOutShort, NewRecallCommander("echo a; echo b"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, lines)
+
+	lines, err = RunT[[]string](
+		sh, timeOutShort, NewRecallCommander("echo a; echo bad 1>&2"))
+	var se *StdErrError
+	assert.True(t, errors.As(err, &se))
+	assert.Equal(t, []string{"a"}, lines)
+
+	ids, err := RunT[[]bus](sh, timeOutShort,
+		NewJSONCommander[bus](`echo '[{"id": 7}]'`, JSONAuto))
+	assert.NoError(t, err)
+	assert.Equal(t, []bus{{ID: 7}}, ids)
+
+	_, err = RunT[[]bus](sh, timeOutShort,
+		NewJSONCommander[bus](`echo '[{"id": "x"}]'`, JSONAuto))
+	var de *JSONDecodeError
+	assert.True(t, errors.As(err, &de))
+
+	// An infrastructure error wins, and ends the shell.
+	_, err = RunT[[]string](sh, timeOutTiny, NewRecallCommander("sleep 1"))
+	assert.ErrorIs(t, err, ErrDeadline)
+}
+
+func TestRunTTruncated(t *testing.T) {
+	p := makeBinShParams()
+	p.OutputLimits = OutputLimits{MaxLines: 2}
+	sh := NewShell(p)
+	assert.NoError(t, sh.Start(timeOutShort))
+	defer func() { assert.NoError(t, sh.Stop(timeOutShort, "")) }()
+
+	rc := NewRecallCommander("echo a; echo b; echo c")
+	lines, err := RunT(sh, timeOutShort,
+		AsParser(rc, func() (int, error) { return len(rc.DataOut()), nil }))
+	var te *TruncationError
+	assert.True(t, errors.As(err, &te))
+	assert.Equal(t, 2, lines)
+}
+
+func TestAsParserKeepsExtensions(t *testing.T) {
+	sh := NewShell(makeBinShParams())
+	assert.NoError(t, sh.Start(timeOutShort))
+	defer func() { assert.NoError(t, sh.Stop(timeOutShort, "")) }()
+
+	// The Parser wraps a Dialoger, wrapping an OutputLimiter.
+	inner := &limitedCommander{
+		RecallCommander: NewRecallCommander(
+			`printf 'Go? '; read ans; seq 1 5`),
+		limits: OutputLimits{MaxLines: 2},
+	}
+	d := &DialogCommander{
+		Commander: inner,
+		Rules: []Rule{{
+			Pattern: regexp.MustCompile(`Go\? $`), Response: "y"}},
+	}
+	lines, err := RunT(sh, timeOutLong, AsParser(d, func() (int, error) {
+		return len(inner.DataOut()), nil
+	}))
+	var te *TruncationError
+	assert.True(t, errors.As(err, &te))
+	assert.Equal(t, 2, lines)
+	assert.Equal(t, []string{"Go? 1", "2"}, inner.DataOut())
+}
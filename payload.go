@@ -0,0 +1,99 @@
+package shexec
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// Payloader is an optional extension of Commander, for a command that
+// reads data from stdIn, e.g. "base64 -d <<'EOF'".  The payload is
+// streamed to the shell after the command and before the sentinels,
+// without being held in memory, at the pace the shell reads it.
+//
+// The command must know where its data ends, since everything sent
+// after it, e.g. the sentinels, arrives on the same stdIn.  A here-doc
+// ends with its delimiter; psql's "COPY ... FROM STDIN" ends with "\.".
+// Such an end marker can be given as the terminator, which is sent on
+// a line of its own after the payload.  An empty terminator sends
+// nothing.
+type Payloader interface {
+	Payload() (data io.Reader, terminator string)
+}
+
+// PayloadCommander adds a payload to a Commander.
+type PayloadCommander struct {
+	Commander
+	Data       io.Reader
+	Terminator string
+}
+
+func (c *PayloadCommander) Payload() (io.Reader, string) {
+	return c.Data, c.Terminator
+}
+
+func (c *PayloadCommander) Unwrap() Commander { return c.Commander }
+
+// feedPayload starts streaming the Commander's payload, if it has one,
+// to the shell.  The returned channel gets the outcome, or is nil if
+// there's no payload.
+func (eInf *execInfra) feedPayload(c Commander) <-chan error {
+	pl, ok := extension[Payloader](c)
+	if !ok {
+		return nil
+	}
+	chErr := make(chan error, 1)
+	if eInf.channels.Feed == nil {
+		chErr <- shErr("channels don't support payloads")
+		return chErr
+	}
+	data, terminator := pl.Payload()
+	if data == nil {
+		data = strings.NewReader("")
+	}
+	go func() {
+		chErr <- eInf.channels.Feed(&payloadReader{r: data, term: terminator})
+	}()
+	return chErr
+}
+
+// payloadReader reads a payload, then its terminator,
+// making sure the terminator is on a line of its own.
+type payloadReader struct {
+	r    io.Reader
+	term string
+	// last is the last byte read from r, if any was read.
+	last      byte
+	lastValid bool
+	// rest is what remains to be read once r is exhausted.
+	rest []byte
+}
+
+func (pr *payloadReader) Read(data []byte) (int, error) {
+	if pr.r != nil {
+		n, err := pr.r.Read(data)
+		if n > 0 {
+			pr.last, pr.lastValid = data[n-1], true
+		}
+		if !errors.Is(err, io.EOF) {
+			return n, err //nolint:wrapcheck
+		}
+		pr.r = nil
+		if pr.term != "" {
+			if pr.lastValid && pr.last != newLineChar {
+				pr.rest = append(pr.rest, newLineChar)
+			}
+			pr.rest = append(pr.rest, pr.term...)
+			pr.rest = append(pr.rest, newLineChar)
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+	if len(pr.rest) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(data, pr.rest)
+	pr.rest = pr.rest[n:]
+	return n, nil
+}
@@ -0,0 +1,69 @@
+package shexec_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	. "github.com/monopole/shexec"
+	"github.com/stretchr/testify/assert"
+)
+
+// repeatReader endlessly repeats a string.
+type repeatReader struct {
+	s   string
+	off int
+}
+
+func (r *repeatReader) Read(data []byte) (int, error) {
+	n := 0
+	for n < len(data) {
+		c := copy(data[n:], r.s[r.off:])
+		n += c
+		r.off = (r.off + c) % len(r.s)
+	}
+	return n, nil
+}
+
+func TestPayload(t *testing.T) {
+	sh := NewShell(makeBinShParams())
+	assert.NoError(t, sh.Start(timeOutShort))
+
+	// The terminator goes on a line of its own.
+	rc := NewRecallCommander("cat <<'EOF'")
+	assert.NoError(t, sh.Run(timeOutLong, &PayloadCommander{
+		Commander:  rc,
+		Data:       strings.NewReader("hello\n$HOME"),
+		Terminator: "EOF",
+	}))
+	assert.Equal(t, []string{"hello", "$HOME"}, rc.DataOut())
+
+	// A payload much bigger than any pipe buffer.
+	const lines = 200000
+	rc = NewRecallCommander("wc -l <<'EOF'")
+	assert.NoError(t, sh.Run(timeOutLong, &PayloadCommander{
+		Commander: rc,
+		Data: io.LimitReader(
+			&repeatReader{s: "0123456789\n"}, 11*lines),
+		Terminator: "EOF",
+	}))
+	if assert.Len(t, rc.DataOut(), 1) {
+		assert.Equal(t, "200000", strings.TrimSpace(rc.DataOut()[0]))
+	}
+
+	// Without a payload, only the terminator is sent.
+	rc = NewRecallCommander("cat <<'EOF'")
+	assert.NoError(t, sh.Run(timeOutLong, &PayloadCommander{
+		Commander: rc, Terminator: "EOF",
+	}))
+	assert.Empty(t, rc.DataOut())
+
+	oops := errors.New("oops")
+	err := sh.Run(timeOutLong, &PayloadCommander{
+		Commander: NewRecallCommander("cat <<'EOF'"),
+		Data:      iotest.ErrReader(oops),
+	})
+	assert.ErrorIs(t, err, oops)
+}
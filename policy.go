@@ -0,0 +1,565 @@
+package shexec
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// PolicyAction is what a PolicyRule does to a command it matches.
+type PolicyAction int
+
+const (
+	PolicyAllow PolicyAction = iota
+	PolicyDeny
+)
+
+func (a PolicyAction) String() string {
+	switch a {
+	case PolicyAllow:
+		return "allow"
+	case PolicyDeny:
+		return "deny"
+	default:
+		return fmt.Sprintf("PolicyAction(%d)", int(a))
+	}
+}
+
+// ArgvDialect says how a command is split into simple commands,
+// and those into words, for matching PolicyRule.Argv.
+type ArgvDialect int
+
+const (
+	// ArgvSh splits as a POSIX shell would, at ; & | ( ) and newlines,
+	// and in the commands substituted by $(...) and backquotes, without
+	// expanding anything.  Quotes and backslashes are removed, as are
+	// redirections, e.g. "2>&1", and leading variable assignments and
+	// reserved words, e.g. "{", "!" or "then".  "&>" is taken as "&"
+	// then ">", so what follows it is judged as a command of its own.
+	// A word matches Argv[0] if its base name does, e.g. "/bin/rm"
+	// matches "rm".
+	ArgvSh ArgvDialect = iota
+	// ArgvSQL splits statements at semicolons, and words at white space
+	// and parentheses and commas.  Comments are dropped.  Words match
+	// regardless of case, e.g. "drop" matches "DROP".
+	ArgvSQL
+)
+
+// PolicyRule matches commands by exactly one of Prefix, Regexp or Argv.
+type PolicyRule struct {
+	Action PolicyAction
+
+	// Prefix matches a simple command (see Argv) starting with it,
+	// as written, from its first word on.
+	Prefix string
+
+	// Regexp matches a simple command holding a match for it.
+	Regexp *regexp.Regexp
+
+	// Argv matches a simple command, i.e. one of the commands making
+	// up a pipeline or list, if the simple command's first word is
+	// Argv[0], and its other words include all of Argv[1:], in any
+	// order.  E.g. {"rm", "-rf"} matches "cd /; rm -rf tmp", but not
+	// "rm -r -f tmp", which needs a rule of its own.
+	Argv []string
+
+	// Name, if not empty, identifies the rule in errors and logs.
+	Name string
+}
+
+func (r *PolicyRule) String() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	switch {
+	case r.Regexp != nil:
+		return fmt.Sprintf("%s regexp %q", r.Action, r.Regexp)
+	case r.Argv != nil:
+		return fmt.Sprintf("%s argv %q", r.Action, r.Argv)
+	default:
+		return fmt.Sprintf("%s prefix %q", r.Action, r.Prefix)
+	}
+}
+
+// Validate returns an error if there's a problem in the PolicyRule.
+func (r *PolicyRule) Validate() error {
+	n := 0
+	if r.Prefix != "" {
+		n++
+	}
+	if r.Regexp != nil {
+		n++
+	}
+	if len(r.Argv) > 0 {
+		n++
+	}
+	if n != 1 {
+		return shErr(
+			"rule %s must have exactly one of Prefix, Regexp or Argv", r)
+	}
+	if r.Action != PolicyAllow && r.Action != PolicyDeny {
+		return shErr("rule %s has bad action", r)
+	}
+	return nil
+}
+
+// Policy decides which commands Run may send to the shell.
+//
+// A command is split into simple commands (see ArgvDialect), and each
+// is judged by the first rule matching it, or by Default if no rule
+// does.  A command is rejected if any of its simple commands is
+// denied, so an allowlist, i.e. a Policy with PolicyDeny as Default,
+// can't be circumvented by appending "; rm -rf /".
+//
+// A Dialoger's responses are commands too, as far as the shell knows,
+// so they're judged the same way: static responses before the command
+// is sent, and responses computed by Rule.Respond before each is sent.
+// A payload is streamed, so it can't be judged in advance; a Payloader
+// is rejected unless AllowPayloads is set.
+//
+// A Policy is a guardrail, not a sandbox.  It sees commands as written,
+// so it doesn't know, e.g., that sudo, xargs or eval run other commands,
+// or what a variable or alias expands to.
+type Policy struct {
+	Rules   []PolicyRule
+	Default PolicyAction
+	Dialect ArgvDialect
+
+	// AllowPayloads, if true, lets a Payloader's data through unjudged,
+	// e.g. for the transfer package.  Only set it if the commands
+	// allowed can't be made to run their input, e.g. as "sh" would.
+	AllowPayloads bool
+
+	// DryRun, if true, logs rejections rather than making them.
+	DryRun bool
+}
+
+// PolicyError is returned by Run when a Policy rejects a command.
+// The command isn't sent, and the shell remains ready for another.
+type PolicyError struct {
+	// Command is the (abbreviated) command rejected.
+	Command string
+	// Rule describes the rule rejecting it, or is "default".
+	Rule string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf(
+		"%s; command %q rejected by policy (%s)",
+		errCategory, e.Command, e.Rule)
+}
+
+// Validate returns an error if there's a problem in the Policy.
+func (p *Policy) Validate() error {
+	for i := range p.Rules {
+		if err := p.Rules[i].Validate(); err != nil {
+			//nolint:wrapcheck
+			return err
+		}
+	}
+	if p.Default != PolicyAllow && p.Default != PolicyDeny {
+		return shErr("policy has bad default action")
+	}
+	if p.Dialect != ArgvSh && p.Dialect != ArgvSQL {
+		return shErr("policy has bad dialect")
+	}
+	return nil
+}
+
+// Check returns a *PolicyError if the Policy rejects the command.
+// In a dry run, it returns nil; Run logs the rejection.
+// A nil Policy allows everything.
+func (p *Policy) Check(command string) error {
+	if p == nil || p.DryRun {
+		return nil
+	}
+	return p.check(command, abbrev)
+}
+
+// vet is Check for a Shell, whose logger
+// abbreviates the command and logs a dry run.
+func (p *Policy) vet(command string, lgr *shLogger) error {
+	if p == nil {
+		return nil
+	}
+	return p.dryRun(p.check(command, lgr.abbrev), lgr)
+}
+
+// vetInput is vet for what the Commander sends to the shell after its
+// command, i.e. a payload or a Dialog's static responses.
+func (p *Policy) vetInput(c Commander, lgr *shLogger) error {
+	if p == nil {
+		return nil
+	}
+	if _, ok := extension[Payloader](c); ok && !p.AllowPayloads {
+		err := &PolicyError{Command: lgr.abbrev(c.Command()), Rule: "payload"}
+		if err := p.dryRun(err, lgr); err != nil {
+			return err
+		}
+	}
+	if dl, ok := extension[Dialoger](c); ok {
+		for _, r := range dl.Dialog().Rules {
+			if r.Respond != nil {
+				// Judged when computed.
+				continue
+			}
+			if err := p.vet(r.Response, lgr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dryRun logs the error and returns nil, in a dry run.
+func (p *Policy) dryRun(err error, lgr *shLogger) error {
+	if err != nil && p.DryRun {
+		lgr.Printf("policy dry run; %v", err)
+		return nil
+	}
+	return err
+}
+
+func (p *Policy) check(command string, abbrev func(string) string) error {
+	cmds := p.split(command)
+	if len(cmds) == 0 {
+		// Judge empty commands, too.
+		cmds = []simpleCommand{{}}
+	}
+	for _, sc := range cmds {
+		rule := p.judge(sc)
+		if rule == nil {
+			if p.Default == PolicyDeny {
+				return &PolicyError{Command: abbrev(command), Rule: "default"}
+			}
+			continue
+		}
+		if rule.Action == PolicyDeny {
+			return &PolicyError{Command: abbrev(command), Rule: rule.String()}
+		}
+	}
+	return nil
+}
+
+// judge returns the first rule matching the simple command,
+// or nil if none do.
+func (p *Policy) judge(sc simpleCommand) *PolicyRule {
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		switch {
+		case r.Prefix != "":
+			if strings.HasPrefix(sc.text, r.Prefix) {
+				return r
+			}
+		case r.Regexp != nil:
+			if r.Regexp.MatchString(sc.text) {
+				return r
+			}
+		default:
+			if p.matchArgv(r.Argv, sc.words) {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Policy) matchArgv(argv, words []string) bool {
+	if len(argv) == 0 || len(words) == 0 {
+		return false
+	}
+	eq := func(a, b string) bool { return a == b }
+	name := words[0]
+	if p.Dialect == ArgvSQL {
+		eq = strings.EqualFold
+	} else if !strings.Contains(argv[0], "/") {
+		name = path.Base(name)
+	}
+	if !eq(name, argv[0]) {
+		return false
+	}
+	for _, a := range argv[1:] {
+		if !slices.ContainsFunc(
+			words[1:], func(w string) bool { return eq(w, a) }) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Policy) split(command string) []simpleCommand {
+	if p.Dialect == ArgvSQL {
+		return splitSQL(command)
+	}
+	return splitSh(command)
+}
+
+// shAssignment matches a variable assignment preceding a command.
+// nolint:gochecknoglobals
+var shAssignment = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// shReserved holds the reserved words that may precede a command.
+// nolint:gochecknoglobals
+var shReserved = []string{
+	"{", "}", "!", "if", "then", "else", "elif", "fi",
+	"do", "done", "while", "until", "time",
+}
+
+// shRedirections holds the redirection operators,
+// longest first.
+// nolint:gochecknoglobals
+var shRedirections = []string{
+	"<<<", "<<-", "<<", "<>", "<&", ">>", ">|", ">&", "<", ">",
+}
+
+// simpleCommand is a command split from a larger one.
+type simpleCommand struct {
+	// words are the command's words, less leading assignments
+	// and reserved words, and less redirections.
+	words []string
+	// text is the command as written, from its first word on.
+	text string
+}
+
+// splitSh splits a shell command into simple commands, roughly as
+// a POSIX shell would, expanding nothing.
+func splitSh(command string) []simpleCommand {
+	var (
+		cmds, nested  []simpleCommand
+		words         []string
+		starts        []int
+		word          strings.Builder
+		inWord        bool
+		dropWord      bool
+		i, start, end int
+	)
+	s := command
+	endWord := func() {
+		if inWord {
+			if dropWord {
+				// A redirection's target.
+				dropWord = false
+			} else {
+				words = append(words, word.String())
+				starts = append(starts, start)
+			}
+			word.Reset()
+			inWord = false
+			end = i
+		}
+	}
+	// subst handles the substitution starting s[i:], returning its length.
+	subst := func() int {
+		inner, n := substitution(s[i:])
+		if !strings.HasPrefix(s[i:], "$((") {
+			// Not arithmetic; split the command on its own.
+			nested = append(nested, splitSh(inner)...)
+		}
+		word.WriteString(s[i : i+n])
+		inWord = true
+		return n
+	}
+	endCmd := func() {
+		endWord()
+		dropWord = false
+		for len(words) > 0 && (shAssignment.MatchString(words[0]) ||
+			slices.Contains(shReserved, words[0])) {
+			words, starts = words[1:], starts[1:]
+		}
+		if len(words) > 0 {
+			cmds = append(cmds, simpleCommand{
+				words: words, text: strings.TrimSpace(s[starts[0]:end])})
+		}
+		words, starts = nil, nil
+	}
+	for i = 0; i < len(s); i++ {
+		if !inWord {
+			start = i
+		}
+		ch := s[i]
+		switch {
+		case ch == '\\':
+			if i++; i < len(s) && s[i] != '\n' {
+				word.WriteByte(s[i])
+				inWord = true
+			}
+		case ch == '\'':
+			inWord = true
+			j := strings.IndexByte(s[i+1:], '\'')
+			if j < 0 {
+				j = len(s) - i - 1
+			}
+			word.WriteString(s[i+1 : i+1+j])
+			i += j + 1
+		case ch == '"':
+			inWord = true
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				switch {
+				case s[i] == '\\' && i+1 < len(s) &&
+					strings.IndexByte("\\\"$`\n", s[i+1]) >= 0:
+					if i++; s[i] == '\n' {
+						continue
+					}
+				case isSubstitution(s[i:]):
+					i += subst() - 1
+					continue
+				}
+				word.WriteByte(s[i])
+			}
+		case isSubstitution(s[i:]):
+			i += subst() - 1
+		case ch == '#' && !inWord:
+			j := strings.IndexByte(s[i:], '\n')
+			if j < 0 {
+				j = len(s) - i
+			}
+			i += j - 1
+		case ch == ' ' || ch == '\t':
+			endWord()
+		case ch == '<' || ch == '>':
+			if inWord && isDigits(word.String()) {
+				// The number of the file redirected.
+				word.Reset()
+				inWord = false
+			}
+			endWord()
+			for _, op := range shRedirections {
+				if strings.HasPrefix(s[i:], op) {
+					i += len(op) - 1
+					break
+				}
+			}
+			dropWord = true
+			end = i + 1
+		case strings.IndexByte(";&|()\n", ch) >= 0:
+			// "&&", "||" and "|&" are single operators.  "&>" is
+			// taken as "&" then ">", as a POSIX shell takes it,
+			// so what follows is judged as a command of its own.
+			if i+1 < len(s) && (ch == '&' || ch == '|') &&
+				(s[i+1] == ch || ch == '|' && s[i+1] == '&') {
+				endCmd()
+				i++
+				continue
+			}
+			endCmd()
+		default:
+			word.WriteByte(ch)
+			inWord = true
+		}
+	}
+	endCmd()
+	return append(cmds, nested...)
+}
+
+// isDigits is true if s is a non-empty string of decimal digits.
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+// isSubstitution is true if s starts with $( or a backquote.
+func isSubstitution(s string) bool {
+	return strings.HasPrefix(s, "$(") || strings.HasPrefix(s, "`")
+}
+
+// substitution parses the command substitution, or arithmetic
+// expansion, starting s.  It returns the text inside, and the
+// length of the whole, closer included.  Parentheses are counted
+// without regard to quotes.
+func substitution(s string) (string, int) {
+	if s[0] == '`' {
+		if j := strings.IndexByte(s[1:], '`'); j >= 0 {
+			return s[1 : j+1], j + 2
+		}
+		return s[1:], len(s)
+	}
+	depth := 0
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return s[2:i], i + 1
+			}
+		}
+	}
+	return s[2:], len(s)
+}
+
+// splitSQL splits SQL into statements.
+func splitSQL(command string) []simpleCommand {
+	var (
+		stmts         []simpleCommand
+		words         []string
+		word          strings.Builder
+		inWord        bool
+		i, start, end int
+		first         = -1
+	)
+	s := command
+	endWord := func() {
+		if inWord {
+			if first < 0 {
+				first = start
+			}
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+			end = i
+		}
+	}
+	endStmt := func() {
+		endWord()
+		if len(words) > 0 {
+			stmts = append(stmts, simpleCommand{
+				words: words, text: strings.TrimSpace(s[first:end])})
+		}
+		words, first = nil, -1
+	}
+	for i = 0; i < len(s); i++ {
+		if !inWord {
+			start = i
+		}
+		ch := s[i]
+		switch {
+		case ch == '\'' || ch == '"':
+			// A doubled quote is part of the literal.
+			inWord = true
+			for i++; i < len(s); i++ {
+				if s[i] == ch {
+					if i+1 < len(s) && s[i+1] == ch {
+						i++
+					} else {
+						break
+					}
+				}
+				word.WriteByte(s[i])
+			}
+		case strings.HasPrefix(s[i:], "--"):
+			endWord()
+			j := strings.IndexByte(s[i:], '\n')
+			if j < 0 {
+				j = len(s) - i
+			}
+			i += j
+		case strings.HasPrefix(s[i:], "/*"):
+			endWord()
+			j := strings.Index(s[i+2:], "*/")
+			if j < 0 {
+				j = len(s) - i - 2
+			}
+			i += j + 3
+		case ch == ';':
+			endStmt()
+		case strings.IndexByte(" \t\r\n(),", ch) >= 0:
+			endWord()
+		default:
+			word.WriteByte(ch)
+			inWord = true
+		}
+	}
+	endStmt()
+	return stmts
+}
@@ -0,0 +1,244 @@
+package shexec_test
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	. "github.com/monopole/shexec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	denyList := &Policy{
+		Rules: []PolicyRule{
+			{Action: PolicyDeny, Argv: []string{"rm", "-rf"}},
+			{Action: PolicyDeny, Argv: []string{"shutdown"}},
+			{Action: PolicyDeny, Prefix: "reboot"},
+			{Action: PolicyDeny, Regexp: regexp.MustCompile(`>\s*/dev/sd`),
+				Name: "no raw disks"},
+		},
+	}
+	allowList := &Policy{
+		Rules: []PolicyRule{
+			{Action: PolicyAllow, Argv: []string{"ls"}},
+			{Action: PolicyAllow, Argv: []string{"grep"}},
+			{Action: PolicyAllow, Argv: []string{"date"}},
+			{Action: PolicyAllow, Argv: []string{"echo"}},
+		},
+		Default: PolicyDeny,
+	}
+	prefixList := &Policy{
+		Rules: []PolicyRule{
+			{Action: PolicyAllow, Prefix: "git "},
+			{Action: PolicyAllow, Prefix: "grep "},
+			{Action: PolicyAllow, Regexp: regexp.MustCompile(`^ls( -l)?$`)},
+		},
+		Default: PolicyDeny,
+	}
+	sqlList := &Policy{
+		Rules: []PolicyRule{
+			{Action: PolicyDeny, Argv: []string{"drop"}},
+			{Action: PolicyDeny, Argv: []string{"delete"}},
+		},
+		Dialect: ArgvSQL,
+	}
+	tests := map[string]struct {
+		p       *Policy
+		command string
+		rule    string
+	}{
+		"nil policy": {command: "rm -rf /"},
+		"plain":      {p: denyList, command: "ls -l"},
+		"argv": {
+			p: denyList, command: "rm -rf /tmp/x",
+			rule: `deny argv ["rm" "-rf"]`},
+		"argv any order": {
+			p: denyList, command: "rm /tmp/x -rf",
+			rule: `deny argv ["rm" "-rf"]`},
+		"argv path": {
+			p: denyList, command: "/bin/rm -rf x",
+			rule: `deny argv ["rm" "-rf"]`},
+		"argv quoted": {
+			p: denyList, command: `'rm' "-rf" x`,
+			rule: `deny argv ["rm" "-rf"]`},
+		"argv in list": {
+			p: denyList, command: "cd /tmp && FOO=1 shutdown -h now",
+			rule: `deny argv ["shutdown"]`},
+		"argv in pipeline": {
+			p: denyList, command: "echo y | shutdown",
+			rule: `deny argv ["shutdown"]`},
+		"argv substituted": {
+			p: denyList, command: `echo "$(shutdown)"`,
+			rule: `deny argv ["shutdown"]`},
+		"argv backquoted": {
+			p: denyList, command: "echo `shutdown`",
+			rule: `deny argv ["shutdown"]`},
+		"argv is data":    {p: denyList, command: "echo 'rm -rf /'"},
+		"argv in comment": {p: denyList, command: "ls # shutdown"},
+		"prefix": {
+			p: denyList, command: "  reboot now",
+			rule: `deny prefix "reboot"`},
+		"regexp": {
+			p: denyList, command: "cat x > /dev/sda", rule: "no raw disks"},
+		"allowed": {
+			p: allowList, command: `ls -l | grep "$(date)"; echo $((1+2))`},
+		"not allowed": {
+			p: allowList, command: "ls; cat /etc/passwd", rule: "default"},
+		"empty not allowed": {p: allowList, command: "", rule: "default"},
+		"redirections": {
+			p:       allowList,
+			command: `ls 2>&1; echo x >&2; ls &>/dev/null; ls <&0 >>log`},
+		"redirection first": {
+			p: denyList, command: "2>/dev/null >x rm -rf /",
+			rule: `deny argv ["rm" "-rf"]`},
+		"and or": {p: allowList, command: "ls && echo a || echo b |& grep a"},
+		"background": {
+			p: denyList, command: "ls &>x shutdown",
+			rule: `deny argv ["shutdown"]`},
+		"braces": {
+			p: denyList, command: "{ rm -rf /; }",
+			rule: `deny argv ["rm" "-rf"]`},
+		"if": {
+			p: denyList, command: "if :; then rm -rf /; fi",
+			rule: `deny argv ["rm" "-rf"]`},
+		"bang": {
+			p: denyList, command: "! rm -rf /",
+			rule: `deny argv ["rm" "-rf"]`},
+		"while": {
+			p: denyList, command: "while :; do shutdown; done",
+			rule: `deny argv ["shutdown"]`},
+		"reserved allowed": {
+			p:       allowList,
+			command: "if ls; then echo y; elif ! ls; then date; else :; fi",
+			rule:    "default"},
+		"reserved compound": {
+			p:       allowList,
+			command: "{ ls; }; while ls; do echo; done; time ! date"},
+		"prefix allowed": {
+			p: prefixList, command: "git status; FOO=1 git log | grep x"},
+		"prefix appended": {
+			p: prefixList, command: "git status; rm -rf /", rule: "default"},
+		"prefix substituted": {
+			p: prefixList, command: "git log $(rm -rf /)", rule: "default"},
+		"regexp appended": {
+			p: prefixList, command: "ls -l && rm -rf /", rule: "default"},
+		"sql": {p: sqlList, command: "SELECT * FROM t; -- drop t"},
+		"sql drop": {
+			p: sqlList, command: "select 1; DROP TABLE t;",
+			rule: `deny argv ["drop"]`},
+		"sql literal": {p: sqlList, command: "insert into t values ('x;drop')"},
+		"sql comment": {
+			p: sqlList, command: "/* hi */delete from t",
+			rule: `deny argv ["delete"]`},
+	}
+	for n, tc := range tests {
+		t.Run(n, func(t *testing.T) {
+			err := tc.p.Check(tc.command)
+			if tc.rule == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var pe *PolicyError
+			if assert.True(t, errors.As(err, &pe)) {
+				assert.Equal(t, tc.rule, pe.Rule)
+			}
+		})
+	}
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	p := &Policy{Rules: []PolicyRule{{Action: PolicyDeny}}}
+	assert.Error(t, p.Validate())
+	p.Rules[0].Prefix, p.Rules[0].Argv = "rm", []string{"rm"}
+	assert.Error(t, p.Validate())
+	p.Rules[0].Argv = nil
+	assert.NoError(t, p.Validate())
+	p.Default = 7
+	assert.Error(t, p.Validate())
+}
+
+func TestPolicyInShell(t *testing.T) {
+	p := makeBinShParams()
+	p.Policy = &Policy{
+		Rules: []PolicyRule{
+			{Action: PolicyDeny, Argv: []string{"exit"}},
+			{Action: PolicyDeny, Argv: []string{"printf"}},
+		},
+	}
+	sh := NewShell(p)
+	assert.NoError(t, sh.Start(timeOutShort))
+
+	// The command is rejected, but the shell is still there.
+	err := sh.Run(timeOutShort, NewRecallCommander("exit 3"))
+	var pe *PolicyError
+	assert.True(t, errors.As(err, &pe))
+	rc := NewRecallCommander("echo alive")
+	assert.NoError(t, sh.Run(timeOutShort, rc))
+	assert.Equal(t, []string{"alive"}, rc.DataOut())
+
+	// A dry run just logs, and the command runs.
+	p.Policy.DryRun = true
+	rc = NewRecallCommander("printf 'dry\\n'")
+	assert.NoError(t, sh.Run(timeOutShort, rc))
+	assert.Equal(t, []string{"dry"}, rc.DataOut())
+	assert.NoError(t, sh.Stop(timeOutShort, ""))
+}
+
+func TestPolicyInShell_input(t *testing.T) {
+	p := makeBinShParams()
+	p.Policy = &Policy{
+		Rules: []PolicyRule{{Action: PolicyDeny, Argv: []string{"rm"}}},
+	}
+	sh := NewShell(p)
+	assert.NoError(t, sh.Start(timeOutShort))
+	var pe *PolicyError
+
+	// The shell would run the payload as commands.
+	err := sh.Run(timeOutShort, &PayloadCommander{
+		Commander: NewRecallCommander("true"),
+		Data:      strings.NewReader("rm -rf /\n"),
+	})
+	assert.True(t, errors.As(err, &pe))
+	assert.Equal(t, "payload", pe.Rule)
+
+	// Unless payloads are allowed.
+	p.Policy.AllowPayloads = true
+	rc := NewRecallCommander("cat <<'EOF'")
+	assert.NoError(t, sh.Run(timeOutShort, &PayloadCommander{
+		Commander:  rc,
+		Data:       strings.NewReader("rm -rf /\n"),
+		Terminator: "EOF",
+	}))
+	assert.Equal(t, []string{"rm -rf /"}, rc.DataOut())
+	p.Policy.AllowPayloads = false
+
+	// A static response is judged before the command is sent.
+	rc = NewRecallCommander(`printf 'Next? '; read c; eval "$c"`)
+	err = sh.Run(timeOutShort, &DialogCommander{
+		Commander: rc,
+		Rules: []Rule{{
+			Pattern:  regexp.MustCompile(`Next\? $`),
+			Response: "rm -rf /",
+		}},
+	})
+	assert.True(t, errors.As(err, &pe))
+	assert.Equal(t, "deny argv [\"rm\"]", pe.Rule)
+	rc = NewRecallCommander("echo alive")
+	assert.NoError(t, sh.Run(timeOutShort, rc))
+	assert.Equal(t, []string{"alive"}, rc.DataOut())
+
+	// A computed one is judged before it's sent, by which time the
+	// command is waiting for it, so the shell is stopped.
+	err = sh.Run(timeOutShort, &DialogCommander{
+		Commander: NewRecallCommander(`printf 'Next? '; read c; eval "$c"`),
+		Rules: []Rule{{
+			Pattern: regexp.MustCompile(`Next\? $`),
+			Respond: func([]string) (string, error) { return "rm -rf /", nil },
+		}},
+	})
+	assert.ErrorContains(t, err, "rejected by policy")
+	assert.False(t, errors.As(err, &pe))
+	assert.Error(t, sh.Run(timeOutShort, NewRecallCommander("echo")))
+}
@@ -0,0 +1,179 @@
+// Package quote builds command text safely from untrusted values.
+package quote
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Dialect is a way of quoting a string so that the receiving
+// interpreter sees exactly the string, and nothing but the string.
+type Dialect int
+
+const (
+	// Sh quotes for POSIX shells, using single quotes.
+	// Strings made entirely of characters that are never special
+	// are left alone.  A shell cannot pass a NUL byte in a word.
+	Sh Dialect = iota
+	// Bash is like Sh, but uses an ANSI-C $'...' string if the
+	// string holds control characters, so that they're visible
+	// and survive line-oriented transports.
+	Bash
+	// SQL makes an SQL string literal, doubling single quotes.
+	// Backslashes are not special, as per the SQL standard, so this
+	// is safe for PostgreSQL (with standard_conforming_strings on,
+	// the default since 9.1), SQLite, Oracle and SQL Server, but NOT
+	// for MySQL or MariaDB, where a backslash escapes the quote after
+	// it; use MySQL for those.
+	SQL
+	// Python makes a Python str literal.
+	// Invalid UTF-8 is replaced by U+FFFD.
+	Python
+	// MySQL is like SQL, but also doubles backslashes, as MySQL and
+	// MariaDB treat them as escapes.  It's safe in any sql_mode, but
+	// with NO_BACKSLASH_ESCAPES, backslashes arrive doubled.
+	MySQL
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case Sh:
+		return "sh"
+	case Bash:
+		return "bash"
+	case SQL:
+		return "sql"
+	case Python:
+		return "python"
+	case MySQL:
+		return "mysql"
+	default:
+		return fmt.Sprintf("Dialect(%d)", int(d))
+	}
+}
+
+// Quote returns s quoted for the dialect.
+func (d Dialect) Quote(s string) string {
+	switch d {
+	case Bash:
+		if needsANSIC(s) {
+			return ansiC(s)
+		}
+		return sh(s)
+	case SQL:
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	case MySQL:
+		return "'" + mysqlReplacer.Replace(s) + "'"
+	case Python:
+		return python(s)
+	default:
+		return sh(s)
+	}
+}
+
+// Join quotes each argument, and joins them with the dialect's
+// list separator; a space for shells, a comma and a space for
+// SQL and Python.
+func (d Dialect) Join(args ...string) string {
+	sep := " "
+	if d == SQL || d == MySQL || d == Python {
+		sep = ", "
+	}
+	q := make([]string, len(args))
+	for i, a := range args {
+		q[i] = d.Quote(a)
+	}
+	return strings.Join(q, sep)
+}
+
+// nolint:gochecknoglobals
+var mysqlReplacer = strings.NewReplacer(`\`, `\\`, "'", "''")
+
+func sh(s string) string {
+	if s != "" && strings.IndexFunc(s, isShUnsafe) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// isShUnsafe is true for characters that might mean something to a
+// shell, in any position.
+func isShUnsafe(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return false
+	}
+	return !strings.ContainsRune("_@%+=:,./-", r)
+}
+
+func needsANSIC(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] == 0x7f {
+			return true
+		}
+	}
+	return !utf8.ValidString(s)
+}
+
+func ansiC(s string) string {
+	var b strings.Builder
+	b.WriteString("$'")
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' || c == '\'':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c < ' ' || c == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		case c >= utf8.RuneSelf:
+			r, n := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && n == 1 {
+				fmt.Fprintf(&b, `\x%02x`, c)
+				continue
+			}
+			b.WriteString(s[i : i+n])
+			i += n - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+func python(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range strings.ToValidUTF8(s, "�") {
+		switch {
+		case r == '\\' || r == '\'':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x100 && !unicode.IsPrint(r):
+			fmt.Fprintf(&b, `\x%02x`, r)
+		case r < 0x10000 && !unicode.IsPrint(r):
+			fmt.Fprintf(&b, `\u%04x`, r)
+		case !unicode.IsPrint(r):
+			fmt.Fprintf(&b, `\U%08x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
@@ -0,0 +1,158 @@
+package quote_test
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/monopole/shexec"
+	"github.com/monopole/shexec/channeler"
+	. "github.com/monopole/shexec/quote"
+	"github.com/stretchr/testify/assert"
+)
+
+const timeOut = 800 * time.Millisecond
+
+var nasty = []string{
+	"",
+	"plain",
+	"a/b.c:d=e,f@g%h+i-j",
+	"two words",
+	"it's",
+	`"double"`,
+	`back\slash`,
+	"$(rm -rf /)",
+	"`id`; echo pwned",
+	"new\nline",
+	"tab\there\r\x01\x7f",
+	"héllo, 世界",
+	"bad \xff utf8",
+	"*?[]{}~!#&|<>()",
+}
+
+func TestQuote(t *testing.T) {
+	testCases := map[string]struct {
+		d        Dialect
+		in       string
+		expected string
+	}{
+		"shPlain":      {Sh, "a/b.c", "a/b.c"},
+		"shEmpty":      {Sh, "", "''"},
+		"shSpace":      {Sh, "a b", "'a b'"},
+		"shQuote":      {Sh, "it's", `'it'\''s'`},
+		"shNewLine":    {Sh, "a\nb", "'a\nb'"},
+		"bashNewLine":  {Bash, "a\nb", `$'a\nb'`},
+		"bashQuote":    {Bash, "it's\t", `$'it\'s\t'`},
+		"bashPlain":    {Bash, "it's", `'it'\''s'`},
+		"sql":          {SQL, "it's", "'it''s'"},
+		"sqlBackslash": {SQL, `a\'`, `'a\'''`},
+		// Safe only where backslashes aren't escapes.
+		"sqlBreakout": {SQL, `\' OR 1=1 -- `, `'\'' OR 1=1 -- '`},
+		"mysql":       {MySQL, "it's", "'it''s'"},
+		// Escaping only the quote would leave "\''", i.e. an escaped
+		// quote, then a quote ending the literal.
+		"mysqlBreakout": {MySQL, `\' OR 1=1 -- `, `'\\'' OR 1=1 -- '`},
+		"python":        {Python, "it's\n\\", `'it\'s\n\\'`},
+		"pythonCtrl":    {Python, "\x00\u200b", `'\x00\u200b'`},
+		"pythonUTF8":    {Python, "héllo", `'héllo'`},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.d.Quote(tc.in))
+		})
+	}
+	assert.Equal(t, "a 'b c' ''", Sh.Join("a", "b c", ""))
+	assert.Equal(t, "'a', 'b'", SQL.Join("a", "b"))
+	assert.Equal(t, `'a\\', 'b'`, MySQL.Join(`a\`, "b"))
+}
+
+// TestQuoteRoundTrip has real interpreters decode quoted strings.
+func TestQuoteRoundTrip(t *testing.T) {
+	for _, s := range nasty {
+		out, err := exec.Command("/bin/sh", "-c", "printf %s "+Sh.Quote(s)).Output()
+		assert.NoError(t, err)
+		assert.Equal(t, s, string(out))
+		if _, err = exec.LookPath("bash"); err == nil {
+			out, err = exec.Command("bash", "-c", "printf %s "+Bash.Quote(s)).Output()
+			assert.NoError(t, err)
+			assert.Equal(t, s, string(out))
+		}
+		if _, err = exec.LookPath("python3"); err == nil {
+			out, err = exec.Command("python3", "-c",
+				"import sys; sys.stdout.write("+Python.Quote(s)+")").Output()
+			assert.NoError(t, err)
+			assert.Equal(t, strings.ToValidUTF8(s, "\uFFFD"), string(out))
+		}
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	tmpl := MustTemplate(Sh, "ls", `ls {{.Flags | raw}} {{.Dir}}
+{{- range .Files}} {{.}}{{end}}
+{{- if .Grep}} | grep {{.Grep}}{{end}} # {{printf "%d files" (len .Files)}}`)
+	cmd, err := tmpl.Execute(map[string]any{
+		"Flags": "-l -a",
+		"Dir":   "my dir; rm -rf /",
+		"Files": []string{"a", "b'c"},
+		"Grep":  "$HOME",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t,
+		`ls -l -a 'my dir; rm -rf /' a 'b'\''c' | grep '$HOME' # '2 files'`,
+		cmd)
+
+	// Slices are quoted element-wise; explicit dialects compose.
+	tmpl = MustTemplate(Sh, "q",
+		`echo {{.Args}}; db -c {{printf "select * from t where n = %s" (sql .Name) | sh}}`)
+	cmd, err = tmpl.Execute(map[string]any{
+		"Args": []string{"x y", "z"},
+		"Name": "O'Brien",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t,
+		`echo 'x y' z; db -c 'select * from t where n = '\''O'\'''\''Brien'\'''`,
+		cmd)
+
+	_, err = tmpl.Execute(map[string]any{"Args": nil})
+	assert.Error(t, err)
+
+	// Quoting for another dialect doesn't make a value safe for the
+	// shell; a Python literal may hold a quote the shell would end.
+	const evil = `x'; touch /tmp/pwned #`
+	tmpl = MustTemplate(Sh, "py",
+		`python3 -c {{printf "print(%s)" (python .X)}}; echo {{.X | python}}`)
+	cmd, err = tmpl.Execute(map[string]any{"X": evil})
+	assert.NoError(t, err)
+	lit := Python.Quote(evil)
+	assert.Equal(t, "python3 -c "+Sh.Quote("print("+lit+")")+
+		"; echo "+Sh.Quote(lit), cmd)
+
+	_, err = NewTemplate(Sh, "bad", "{{.X")
+	assert.Error(t, err)
+}
+
+func TestTemplateCommander(t *testing.T) {
+	sh := shexec.NewShell(shexec.Parameters{
+		Params: channeler.Params{Path: "/bin/sh"},
+		SentinelOut: shexec.Sentinel{
+			C: "echo sentinel8a4f", V: "sentinel8a4f"},
+	})
+	assert.NoError(t, sh.Start(timeOut))
+	tmpl := MustTemplate(Sh, "echo", "printf '%s\\n' {{.}}")
+	for _, s := range nasty[1:] {
+		rc := shexec.NewRecallCommander("")
+		c, err := tmpl.Commander(s, rc)
+		assert.NoError(t, err)
+		assert.NoError(t, sh.Run(timeOut, c))
+		if s == "new\nline" {
+			assert.Equal(t, []string{"new", "line"}, rc.DataOut())
+			continue
+		}
+		if s == "tab\there\r\x01\x7f" {
+			continue // carriage return is dropped by the line reader
+		}
+		assert.Equal(t, []string{s}, rc.DataOut())
+	}
+	assert.NoError(t, sh.Stop(timeOut, ""))
+}
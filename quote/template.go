@@ -0,0 +1,166 @@
+package quote
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/monopole/shexec"
+)
+
+const (
+	// funcQuote quotes in the template's dialect; it's appended to
+	// every action that doesn't already end in it, in the function
+	// named for the template's dialect, or in raw.
+	funcQuote = "quote"
+	// funcRaw inserts a value without quoting it.
+	funcRaw = "raw"
+)
+
+// Template is a text/template for making commands, in which every
+// value interpolated by an action, e.g. {{.Name}}, is quoted in the
+// template's Dialect.
+//
+// Values may be quoted in another dialect too, with the functions
+// "sh", "bash", "sql", "mysql" and "python", e.g. in an Sh template,
+// {{.Query | sql}} quotes for SQL, then quotes the result for the
+// shell, as does {{.Query | sql | sh}}.  Only an action ending in the
+// function named for the template's dialect isn't quoted again.
+// A slice of strings is quoted element by element, and joined as
+// by Dialect.Join.
+//
+// To insert a value without quoting, which is almost always a
+// mistake with untrusted data, end the action with "raw",
+// e.g. {{.Flags | raw}} or {{raw .Flags}}.
+type Template struct {
+	d Dialect
+	t *template.Template
+}
+
+// NewTemplate parses text as a Template for the given dialect.
+// A missing map key is an error when executing the template.
+func NewTemplate(d Dialect, name, text string) (*Template, error) {
+	t, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{
+			funcQuote:       quoter(d),
+			funcRaw:         func(v any) string { return fmt.Sprint(v) },
+			Sh.String():     quoter(Sh),
+			Bash.String():   quoter(Bash),
+			SQL.String():    quoter(SQL),
+			Python.String(): quoter(Python),
+			MySQL.String():  quoter(MySQL),
+		}).
+		Parse(text)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	for _, tt := range t.Templates() {
+		if tt.Tree != nil {
+			addQuoting(d, tt.Root)
+		}
+	}
+	return &Template{d: d, t: t}, nil
+}
+
+// MustTemplate is like NewTemplate, but panics on error.
+func MustTemplate(d Dialect, name, text string) *Template {
+	t, err := NewTemplate(d, name, text)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Execute returns the command made by applying the template to data.
+func (t *Template) Execute(data any) (string, error) {
+	var b strings.Builder
+	if err := t.t.Execute(&b, data); err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	return b.String(), nil
+}
+
+// Commander returns a Commander issuing the command made by
+// applying the template to data, and using p to parse the output.
+func (t *Template) Commander(
+	data any, p shexec.Commander) (*TemplateCommander, error) {
+	cmd, err := t.Execute(data)
+	if err != nil {
+		return nil, err
+	}
+	return &TemplateCommander{Commander: p, cmd: cmd}, nil
+}
+
+// TemplateCommander is a Commander whose command comes from a
+// Template.  Its parsers are those of the embedded Commander.
+type TemplateCommander struct {
+	shexec.Commander
+	cmd string
+}
+
+func (c *TemplateCommander) Command() string { return c.cmd }
+
+func quoter(d Dialect) func(v any) string {
+	return func(v any) string {
+		if list, ok := v.([]string); ok {
+			return d.Join(list...)
+		}
+		return d.Quote(fmt.Sprint(v))
+	}
+}
+
+// addQuoting appends the quote function to the pipeline of every
+// action under n that prints something and isn't already quoted
+// for the dialect.
+func addQuoting(d Dialect, n parse.Node) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			addQuoting(d, c)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 || endsQuoted(d, n.Pipe) {
+			return
+		}
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args: []parse.Node{
+				parse.NewIdentifier(funcQuote).SetPos(n.Pos),
+			},
+		})
+	case *parse.IfNode:
+		addQuoting(d, n.List)
+		addQuoting(d, n.ElseList)
+	case *parse.RangeNode:
+		addQuoting(d, n.List)
+		addQuoting(d, n.ElseList)
+	case *parse.WithNode:
+		addQuoting(d, n.List)
+		addQuoting(d, n.ElseList)
+	}
+}
+
+// endsQuoted is true if the pipeline's last command quotes for the
+// dialect, or is raw.  Quoting for another dialect doesn't count;
+// e.g. a Python literal isn't safe in a shell command.
+func endsQuoted(d Dialect, p *parse.PipeNode) bool {
+	if len(p.Cmds) == 0 {
+		return false
+	}
+	last := p.Cmds[len(p.Cmds)-1]
+	id, ok := last.Args[0].(*parse.IdentifierNode)
+	if !ok {
+		return false
+	}
+	switch id.Ident {
+	case funcQuote, funcRaw, d.String():
+		return true
+	}
+	return false
+}
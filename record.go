@@ -0,0 +1,241 @@
+package shexec
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/monopole/shexec/channeler"
+)
+
+// tagKey is the struct field tag consulted when filling a struct
+// from command output.  The tag value is either a 0-relative column
+// index, e.g. `shexec:"2"`, or a name, e.g. `shexec:"user"`, or "-"
+// to ignore the field.  A field without a tag is filled from the value
+// whose name matches the field's name, ignoring case, if there is one.
+const tagKey = "shexec"
+
+// record holds the values found in some command output,
+// e.g. a row in a table or the capture groups of a regexp.
+type record struct {
+	// values are ordered by column.
+	values []string
+	// names, if not nil, parallels values.
+	names []string
+	// lenient, if true, tolerates tagged struct fields
+	// naming values that aren't in the record.
+	lenient bool
+}
+
+// lookup returns the value with the given name, ignoring case.
+func (r *record) lookup(name string) (string, bool) {
+	for i, n := range r.names {
+		if strings.EqualFold(n, name) && i < len(r.values) {
+			return r.values[i], true
+		}
+	}
+	return "", false
+}
+
+// asMap returns the record as a map from names to values.
+// Values without names are keyed by their index.
+func (r *record) asMap() map[string]string {
+	m := make(map[string]string, len(r.values))
+	for i, v := range r.values {
+		if i < len(r.names) && r.names[i] != "" {
+			m[r.names[i]] = v
+		} else {
+			m[strconv.Itoa(i)] = v
+		}
+	}
+	return m
+}
+
+// decodeRecord converts a record to a T, which must be a struct,
+// a pointer to a struct, or a map[string]string.
+func decodeRecord[T any](r *record) (result T, err error) {
+	err = fillValue(reflect.ValueOf(&result).Elem(), r)
+	return
+}
+
+func fillValue(v reflect.Value, r *record) error {
+	switch {
+	case v.Kind() == reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+		return fillValue(v.Elem(), r)
+	case v.Kind() == reflect.Struct:
+		return fillStruct(v, r)
+	case v.Type() == reflect.TypeOf(map[string]string{}):
+		v.Set(reflect.ValueOf(r.asMap()))
+		return nil
+	default:
+		return fmt.Errorf(
+			"cannot decode a record into a %s", v.Type()) //nolint:goerr113
+	}
+}
+
+func fillStruct(v reflect.Value, r *record) error {
+	t := v.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag, tagged := f.Tag.Lookup(tagKey)
+		if tag == "-" {
+			continue
+		}
+		var (
+			s     string
+			found bool
+		)
+		if col, err := strconv.Atoi(tag); err == nil {
+			if col >= 0 && col < len(r.values) {
+				s, found = r.values[col], true
+			} else {
+				//nolint:goerr113
+				return fmt.Errorf("field %s wants column %d, but there are %d",
+					f.Name, col, len(r.values))
+			}
+		} else {
+			name := f.Name
+			if tagged {
+				name = tag
+			}
+			s, found = r.lookup(name)
+			if !found && tagged && !r.lenient {
+				//nolint:goerr113
+				return fmt.Errorf(
+					"field %s wants missing value %q", f.Name, name)
+			}
+		}
+		if !found {
+			continue
+		}
+		if err := setField(v.Field(i), s); err != nil {
+			return fmt.Errorf("field %s; %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setField converts s to the type of the settable v, and sets v.
+func setField(v reflect.Value, s string) error {
+	if v.CanAddr() {
+		if tu, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			//nolint:wrapcheck
+			return tu.UnmarshalText([]byte(s))
+		}
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		p := reflect.New(v.Type().Elem())
+		if err := setField(p.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(p)
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		v.SetFloat(n)
+	default:
+		//nolint:goerr113
+		return fmt.Errorf("cannot convert %q to a %s", s, v.Type())
+	}
+	return nil
+}
+
+// ParseError reports a line of command output that couldn't be parsed.
+type ParseError struct {
+	// Stream is the stream holding the line, if it's known;
+	// commanders that parse only stdOut leave it unknown.
+	Stream channeler.Stream
+	// Line is the 1-relative line number in the stream.
+	Line int
+	// Text is the text of the line.
+	Text string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.Stream != channeler.StreamUnknown {
+		return fmt.Sprintf(
+			"%s line %d %q; %v", e.Stream, e.Line, e.Text, e.Err)
+	}
+	return fmt.Sprintf("line %d %q; %v", e.Line, e.Text, e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// parseErrors accumulates ParseErrors.
+type parseErrors []error
+
+func (pe *parseErrors) add(line int, text string, err error) {
+	*pe = append(*pe, &ParseError{Line: line, Text: text, Err: err})
+}
+
+func (pe *parseErrors) addFrom(
+	s channeler.Stream, line int, text string, err error) {
+	*pe = append(*pe,
+		&ParseError{Stream: s, Line: line, Text: text, Err: err})
+}
+
+// err returns all the errors joined, or nil if there are none.
+func (pe parseErrors) err() error { return errors.Join(pe...) }
+
+const newLineChar = '\n'
+
+// lineBuffer accumulates lines, and hands them over on Close.
+type lineBuffer struct {
+	data    []byte
+	onClose func([]byte)
+}
+
+func (lb *lineBuffer) Write(data []byte) (int, error) {
+	lb.data = append(lb.data, data...)
+	lb.data = append(lb.data, newLineChar)
+	return len(data), nil
+}
+
+func (lb *lineBuffer) Close() error {
+	lb.onClose(lb.data)
+	return nil
+}
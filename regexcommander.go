@@ -0,0 +1,181 @@
+package shexec
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"sync"
+
+	"github.com/monopole/shexec/channeler"
+)
+
+// RegexMode says which lines of output a RegexCommander
+// expects to match.
+type RegexMode int
+
+const (
+	// MatchAtLeastOnce ignores lines that match no regexp, but
+	// it's an error if no line matches.
+	MatchAtLeastOnce RegexMode = iota
+	// MatchEveryLine makes it an error for a non-empty line to
+	// match no regexp.
+	MatchEveryLine
+	// MatchFirst keeps only the first record found, ignoring
+	// subsequent lines.  It's an error if no line matches.  With
+	// IncludeErr, the first is decided by the lines' Seq, not by
+	// which stream's parser happens to see its match first.
+	MatchFirst
+)
+
+// ErrNoMatch is reported by a RegexCommander when no line
+// matched, and its mode requires a match.
+var ErrNoMatch = errors.New("no line matched")
+
+// RegexCommander applies regular expressions to each line of a
+// command's output, making a record of type T from the capture
+// groups of each match.  The regexps are tried in order, and the
+// first to match a line wins.
+//
+// T is either map[string]string, keyed by group name (or group
+// number, for unnamed groups, with "0" being the whole match),
+// or a struct whose fields are matched to group names, or to group
+// numbers, by a `shexec` tag (see tagKey).  A tagged field naming
+// a group that the matching regexp lacks is left alone.
+//
+// Lines that cannot be parsed don't fail the call to Run; they're
+// reported by Err.
+// Each Run replaces the results of the previous one.
+type RegexCommander[T any] struct {
+	C        string
+	Patterns []*regexp.Regexp
+	Mode     RegexMode
+	// IncludeErr, if true, makes stdErr subject to the regexps,
+	// as well as stdOut.
+	IncludeErr bool
+
+	mu      sync.Mutex
+	records []T
+	errs    parseErrors
+	// errSeqs holds the Seq of the line behind each of errs,
+	// and firstSeq that of the line behind the record kept
+	// in MatchFirst mode.
+	errSeqs  []uint64
+	firstSeq uint64
+}
+
+// NewRegexCommander returns an instance of RegexCommander.
+func NewRegexCommander[T any](
+	c string, m RegexMode, patterns ...*regexp.Regexp) *RegexCommander[T] {
+	return &RegexCommander[T]{C: c, Mode: m, Patterns: patterns}
+}
+
+func (c *RegexCommander[T]) Command() string { return c.C }
+
+func (c *RegexCommander[T]) ParseOut() io.WriteCloser {
+	c.records, c.errs, c.errSeqs = nil, nil, nil
+	return &regexParser[T]{c: c, stream: channeler.StreamOut}
+}
+
+func (c *RegexCommander[T]) ParseErr() io.WriteCloser {
+	if !c.IncludeErr {
+		return DevNull
+	}
+	return &regexParser[T]{c: c, stream: channeler.StreamErr}
+}
+
+// Records returns the records made from matching lines.
+func (c *RegexCommander[T]) Records() []T { return c.records }
+
+// Err returns an error for each line that could not be parsed,
+// and ErrNoMatch if the mode requires a match and there was none.
+func (c *RegexCommander[T]) Err() error {
+	if len(c.records) == 0 && len(c.errs) == 0 && c.Mode != MatchEveryLine {
+		return ErrNoMatch
+	}
+	return c.errs.err()
+}
+
+// Result returns the records, and the error from Err.
+func (c *RegexCommander[T]) Result() ([]T, error) {
+	return c.records, c.Err()
+}
+
+// match applies the regexps to the line, the given line number
+// of the stream.  A seq of zero means the line's Seq is unknown;
+// such a line is taken to follow all others.
+func (c *RegexCommander[T]) match(
+	s channeler.Stream, line int, seq uint64, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Mode == MatchFirst && len(c.records) > 0 &&
+		!earlier(seq, c.firstSeq) {
+		return
+	}
+	for _, re := range c.Patterns {
+		m := re.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+		rec, err := decodeRecord[T](
+			&record{values: m, names: re.SubexpNames(), lenient: true})
+		if err != nil {
+			c.addErr(s, line, seq, text, err)
+			return
+		}
+		if c.Mode == MatchFirst {
+			c.keepFirst(rec, seq)
+			return
+		}
+		c.records = append(c.records, rec)
+		return
+	}
+	if c.Mode == MatchEveryLine && text != "" {
+		c.addErr(s, line, seq, text, ErrNoMatch)
+	}
+}
+
+func (c *RegexCommander[T]) addErr(
+	s channeler.Stream, line int, seq uint64, text string, err error) {
+	c.errs.addFrom(s, line, text, err)
+	c.errSeqs = append(c.errSeqs, seq)
+}
+
+// keepFirst makes rec the record, dropping
+// errors for the lines that follow it.
+func (c *RegexCommander[T]) keepFirst(rec T, seq uint64) {
+	var (
+		errs    parseErrors
+		errSeqs []uint64
+	)
+	for i, e := range c.errs {
+		if earlier(c.errSeqs[i], seq) {
+			errs, errSeqs = append(errs, e), append(errSeqs, c.errSeqs[i])
+		}
+	}
+	c.records, c.firstSeq = []T{rec}, seq
+	c.errs, c.errSeqs = errs, errSeqs
+}
+
+// earlier is true if the line with Seq a precedes that with Seq b.
+func earlier(a, b uint64) bool {
+	return a != 0 && (b == 0 || a < b)
+}
+
+// regexParser hands each line of a stream to a RegexCommander.
+type regexParser[T any] struct {
+	c      *RegexCommander[T]
+	stream channeler.Stream
+	line   int
+}
+
+func (rp *regexParser[T]) Write(data []byte) (int, error) {
+	return len(data), rp.WriteLine(channeler.Line{Text: data})
+}
+
+func (rp *regexParser[T]) WriteLine(line channeler.Line) error {
+	rp.line++
+	rp.c.match(rp.stream, rp.line, line.Seq, string(line.Text))
+	return nil
+}
+
+func (rp *regexParser[T]) Close() error { return nil }
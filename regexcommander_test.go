@@ -0,0 +1,108 @@
+package shexec_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	. "github.com/monopole/shexec"
+	"github.com/monopole/shexec/channeler"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	reProgress = regexp.MustCompile(`^copied (?P<files>\d+) files? to (?P<dir>\S+)$`)
+	reError    = regexp.MustCompile(`^Error: #(?P<code>\d+): (?P<msg>.*)$`)
+)
+
+func TestRegexCommander(t *testing.T) {
+	sh := NewShell(makeBinShParams())
+	assert.NoError(t, sh.Start(timeOutShort))
+	defer func() { assert.NoError(t, sh.Stop(timeOutShort, "")) }()
+
+	type event struct {
+		Files int    `shexec:"files"`
+		Dir   string `shexec:"dir"`
+		Code  int    `shexec:"code"`
+		Msg   string
+	}
+	const cmd = `
+echo 'starting'
+echo 'copied 3 files to /tmp'
+echo 'Error: #666: lookup failed' 1>&2
+echo 'copied 1 file to /var'`
+
+	c := NewRegexCommander[event](cmd, MatchAtLeastOnce, reProgress, reError)
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	assert.NoError(t, c.Err())
+	assert.Equal(t, []event{
+		{Files: 3, Dir: "/tmp"},
+		{Files: 1, Dir: "/var"},
+	}, c.Records())
+
+	c.IncludeErr = true
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	assert.NoError(t, c.Err())
+	assert.Len(t, c.Records(), 3)
+	assert.Contains(t, c.Records(), event{Code: 666, Msg: "lookup failed"})
+
+	c.Mode = MatchEveryLine
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	var pe *ParseError
+	if assert.True(t, errors.As(c.Err(), &pe)) {
+		assert.Equal(t, 1, pe.Line)
+		assert.Equal(t, "starting", pe.Text)
+		assert.ErrorIs(t, c.Err(), ErrNoMatch)
+	}
+
+	f := NewRegexCommander[map[string]string](cmd, MatchFirst, reProgress)
+	assert.NoError(t, sh.Run(timeOutShort, f))
+	assert.NoError(t, f.Err())
+	assert.Equal(t, []map[string]string{{
+		"0": "copied 3 files to /tmp", "files": "3", "dir": "/tmp",
+	}}, f.Records())
+
+	n := NewRegexCommander[event]("echo nothing", MatchFirst, reError)
+	assert.NoError(t, sh.Run(timeOutShort, n))
+	assert.ErrorIs(t, n.Err(), ErrNoMatch)
+	assert.Empty(t, n.Records())
+}
+
+func TestRegexCommanderFirstBySeq(t *testing.T) {
+	c := NewRegexCommander[map[string]string](
+		"whatever", MatchFirst, reError)
+	c.IncludeErr = true
+	out, ok := c.ParseOut().(LineWriter)
+	assert.True(t, ok)
+	errP, ok := c.ParseErr().(LineWriter)
+	assert.True(t, ok)
+	// stdOut's parser sees its match first,
+	// but stdErr's match has the lower Seq.
+	assert.NoError(t, out.WriteLine(channeler.Line{
+		Text: []byte("Error: #2: later"), Stream: channeler.StreamOut, Seq: 5}))
+	assert.NoError(t, errP.WriteLine(channeler.Line{
+		Text: []byte("Error: #1: sooner"), Stream: channeler.StreamErr, Seq: 3}))
+	assert.NoError(t, out.WriteLine(channeler.Line{
+		Text: []byte("Error: #3: latest"), Stream: channeler.StreamOut, Seq: 6}))
+	if assert.Len(t, c.Records(), 1) {
+		assert.Equal(t, "sooner", c.Records()[0]["msg"])
+	}
+}
+
+func TestRegexCommanderErrStream(t *testing.T) {
+	sh := NewShell(makeBinShParams())
+	assert.NoError(t, sh.Start(timeOutShort))
+	defer func() { assert.NoError(t, sh.Stop(timeOutShort, "")) }()
+
+	c := NewRegexCommander[map[string]string](
+		"echo 'copied 1 file to /x'; echo oops 1>&2", MatchEveryLine,
+		reProgress)
+	c.IncludeErr = true
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	var pe *ParseError
+	if assert.True(t, errors.As(c.Err(), &pe)) {
+		assert.Equal(t, channeler.StreamErr, pe.Stream)
+		assert.Equal(t, 1, pe.Line)
+		assert.Contains(t, pe.Error(), `stdErr line 1 "oops"`)
+	}
+}
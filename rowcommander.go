@@ -0,0 +1,155 @@
+package shexec
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// RowCommander parses stdOut as rows of delimited fields, e.g. CSV,
+// TSV, or conch's "_|_" delimited rows, into values of type T.
+//
+// T is either map[string]string, or a struct whose fields are
+// matched to columns by a `shexec` tag holding a column index or a
+// column name (see tagKey).  Column names come from a header line.
+// Field values are converted to the field's type.
+//
+// Rows that cannot be parsed don't fail the call to Run; they're
+// reported, with their line numbers, by Err.
+// Each Run replaces the results of the previous one.
+type RowCommander[T any] struct {
+	C string
+	// Delimiter separates fields on a line.
+	// If empty, lines are parsed as RFC 4180 CSV, using Comma.
+	Delimiter string
+	// Comma is the CSV field separator; if zero, ',' is used.
+	// Use '\t' for TSV.
+	Comma rune
+	// SkipLines is the number of leading lines to ignore, e.g. a banner.
+	SkipLines int
+	// Header, if true, means the first line after SkipLines
+	// holds column names.
+	Header bool
+	// TrimSpace, if true, trims white space from each field.
+	TrimSpace bool
+
+	rows   []T
+	header []string
+	errs   parseErrors
+}
+
+// NewRowCommander returns a RowCommander splitting lines on
+// the given delimiter.
+func NewRowCommander[T any](c string, delimiter string) *RowCommander[T] {
+	return &RowCommander[T]{C: c, Delimiter: delimiter}
+}
+
+// NewCSVCommander returns a RowCommander parsing CSV with a header.
+func NewCSVCommander[T any](c string) *RowCommander[T] {
+	return &RowCommander[T]{C: c, Header: true}
+}
+
+func (c *RowCommander[T]) Command() string          { return c.C }
+func (c *RowCommander[T]) ParseErr() io.WriteCloser { return DevNull }
+func (c *RowCommander[T]) ParseOut() io.WriteCloser {
+	c.rows, c.header, c.errs = nil, nil, nil
+	if c.Delimiter == "" {
+		return &lineBuffer{onClose: c.parseCSV}
+	}
+	return &rowParser[T]{c: c}
+}
+
+// Rows returns the rows parsed.
+func (c *RowCommander[T]) Rows() []T { return c.rows }
+
+// Columns returns the column names, if Header is true.
+func (c *RowCommander[T]) Columns() []string { return c.header }
+
+// Err returns an error for each row that could not be parsed.
+func (c *RowCommander[T]) Err() error { return c.errs.err() }
+
+// Result returns the rows parsed, and the error from Err.
+func (c *RowCommander[T]) Result() ([]T, error) { return c.rows, c.Err() }
+
+// addRow handles the fields found on the given line.
+func (c *RowCommander[T]) addRow(line int, text string, fields []string) {
+	if c.TrimSpace {
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+	}
+	if c.Header && c.header == nil {
+		c.header = fields
+		return
+	}
+	if c.header != nil && len(fields) != len(c.header) {
+		c.errs.add(line, text, fmt.Errorf(
+			"got %d fields, header has %d", //nolint:goerr113
+			len(fields), len(c.header)))
+		return
+	}
+	row, err := decodeRecord[T](&record{values: fields, names: c.header})
+	if err != nil {
+		c.errs.add(line, text, err)
+		return
+	}
+	c.rows = append(c.rows, row)
+}
+
+func (c *RowCommander[T]) parseCSV(data []byte) {
+	lines := strings.Split(string(data), "\n")
+	skip := min(c.SkipLines, len(lines))
+	rd := csv.NewReader(
+		strings.NewReader(strings.Join(lines[skip:], "\n")))
+	if c.Comma != 0 {
+		rd.Comma = c.Comma
+	}
+	rd.FieldsPerRecord = -1
+	// text returns the text of the nth unskipped line,
+	// and its line number.
+	text := func(n int) (int, string) {
+		n += skip
+		if n > 0 && n <= len(lines) {
+			return n, lines[n-1]
+		}
+		return n, ""
+	}
+	for {
+		fields, err := rd.Read()
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			var pe *csv.ParseError
+			if errors.As(err, &pe) {
+				n, t := text(pe.Line)
+				c.errs.add(n, t, pe.Err)
+				continue
+			}
+			c.errs.add(0, "", err)
+			return
+		}
+		line, _ := rd.FieldPos(0)
+		n, t := text(line)
+		c.addRow(n, t, fields)
+	}
+}
+
+// rowParser splits lines as they arrive.
+type rowParser[T any] struct {
+	c    *RowCommander[T]
+	line int
+}
+
+func (rp *rowParser[T]) Write(data []byte) (int, error) {
+	rp.line++
+	if rp.line > rp.c.SkipLines && len(data) > 0 {
+		text := string(data)
+		rp.c.addRow(rp.line, text, strings.Split(text, rp.c.Delimiter))
+	}
+	return len(data), nil
+}
+
+func (rp *rowParser[T]) Close() error { return nil }
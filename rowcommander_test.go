@@ -0,0 +1,88 @@
+package shexec_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/monopole/shexec"
+	"github.com/stretchr/testify/assert"
+)
+
+type conchRow struct {
+	Fruit    string `shexec:"0"`
+	Asteroid string `shexec:"1"`
+	Revision int    `shexec:"2"`
+	ID       uint64 `shexec:"3"`
+}
+
+func TestRowCommanderConch(t *testing.T) {
+	sh := NewShell(makeConchParams())
+	assert.NoError(t, sh.Start(timeOutLong))
+	c := NewRowCommander[conchRow]("query limit 3", "_|_")
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	assert.NoError(t, c.Err())
+	assert.Equal(t, []conchRow{
+		{"Cempedak", "Bamberga", 4, 1},
+		{"Buddha's hand", "Hermione", 6, 2},
+		{"African cucumber", "Ursula", 6, 3},
+	}, c.Rows())
+	assert.NoError(t, sh.Stop(timeOutShort, ""))
+}
+
+func TestRowCommander(t *testing.T) {
+	sh := NewShell(makeBinShParams())
+	assert.NoError(t, sh.Start(timeOutShort))
+	defer func() { assert.NoError(t, sh.Stop(timeOutShort, "")) }()
+
+	type job struct {
+		Name    string `shexec:"name"`
+		Elapsed time.Duration
+		Done    *bool  `shexec:"finished"`
+		Ignored string `shexec:"-"`
+	}
+	yes, no := true, false
+
+	c := NewCSVCommander[job](`
+echo 'name,elapsed,finished'
+echo 'alpha,1s,true'
+echo '"beta, the second",2m,false'
+echo 'gamma,forever,true'
+echo 'delta,3s'`)
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	assert.Equal(t, []string{"name", "elapsed", "finished"}, c.Columns())
+	assert.Equal(t, []job{
+		{Name: "alpha", Elapsed: time.Second, Done: &yes},
+		{Name: "beta, the second", Elapsed: 2 * time.Minute, Done: &no},
+	}, c.Rows())
+	var pe *ParseError
+	if assert.True(t, errors.As(c.Err(), &pe)) {
+		assert.Equal(t, 4, pe.Line)
+		assert.Equal(t, "gamma,forever,true", pe.Text)
+	}
+	assert.Contains(t, c.Err().Error(), `line 5 "delta,3s"; got 2 fields`)
+
+	// Tab separated, with a banner, into maps.
+	m := NewCSVCommander[map[string]string](
+		`printf 'Jobs report\nid\tstate\n1\tok\n2\t\n'`)
+	m.Comma, m.SkipLines = '\t', 1
+	assert.NoError(t, sh.Run(timeOutShort, m))
+	assert.NoError(t, m.Err())
+	assert.Equal(t, []map[string]string{
+		{"id": "1", "state": "ok"},
+		{"id": "2", "state": ""},
+	}, m.Rows())
+
+	// Custom delimiter, trimmed, with a row too short for the struct.
+	type pair struct {
+		K string `shexec:"0"`
+		V int    `shexec:"1"`
+	}
+	p := NewRowCommander[pair](`printf 'a : 1\nb\nc : 3\n'`, ":")
+	p.TrimSpace = true
+	assert.NoError(t, sh.Run(timeOutShort, p))
+	assert.Equal(t, []pair{{"a", 1}, {"c", 3}}, p.Rows())
+	if assert.True(t, errors.As(p.Err(), &pe)) {
+		assert.Equal(t, 2, pe.Line)
+	}
+}
@@ -0,0 +1,82 @@
+package shexec
+
+import (
+	"errors"
+	"time"
+)
+
+// RunOption modifies a single call to Run.
+type RunOption func(*runOptions)
+
+// OptionRunner is an optional extension of Shell, for a Shell
+// that accepts RunOptions.  The Shells made by NewShell, NewShellRaw
+// and Intercept implement it.
+type OptionRunner interface {
+	// RunWith is Run, modified by the options.
+	RunWith(time.Duration, Commander, ...RunOption) error
+}
+
+// RunWith runs the Commander on the Shell, with the given options.
+// If there are options, the Shell must be an OptionRunner;
+// otherwise nothing is run, and an error is returned.
+func RunWith(
+	sh Shell, d time.Duration, c Commander, opts ...RunOption) error {
+	if or, ok := sh.(OptionRunner); ok {
+		//nolint:wrapcheck
+		return or.RunWith(d, c, opts...)
+	}
+	if len(opts) > 0 {
+		return shErr("shell %T doesn't accept RunOptions", sh)
+	}
+	//nolint:wrapcheck
+	return sh.Run(d, c)
+}
+
+// runOptions holds the effect of all RunOptions given to Run.
+type runOptions struct {
+	// idleTimeout, if positive, is the longest Run will wait
+	// without seeing output on either stream.
+	idleTimeout time.Duration
+}
+
+func makeRunOptions(opts []RunOption) runOptions {
+	var ro runOptions
+	for _, opt := range opts {
+		opt(&ro)
+	}
+	return ro
+}
+
+// WithIdleTimeout makes Run fail if neither stdOut nor stdErr
+// yields any output for the given duration.  The countdown restarts
+// whenever output arrives, even part of a line.  The overall
+// duration passed to Run still applies.
+//
+// Use this for commands that should show signs of life, e.g. a long
+// job that streams progress, so that a hang is noticed long before
+// the overall duration expires.
+func WithIdleTimeout(d time.Duration) RunOption {
+	return func(ro *runOptions) { ro.idleTimeout = d }
+}
+
+var (
+	// ErrDeadline matches (via errors.Is) the error returned by Run
+	// when the command doesn't finish in the duration given to Run.
+	ErrDeadline = errors.New("run deadline exceeded")
+
+	// ErrIdleTimeout matches (via errors.Is) the error returned by Run
+	// when the command produced no output for the duration given
+	// to WithIdleTimeout.
+	ErrIdleTimeout = errors.New("run idle timeout exceeded")
+)
+
+// TimeoutError is returned by Run when a command takes too long.
+// Use errors.Is with ErrDeadline or ErrIdleTimeout to learn which
+// timeout expired.
+type TimeoutError struct {
+	msg  string
+	kind error
+}
+
+func (e *TimeoutError) Error() string { return e.msg }
+func (e *TimeoutError) Unwrap() error { return e.kind }
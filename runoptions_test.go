@@ -0,0 +1,56 @@
+package shexec_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/monopole/shexec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunIdleTimeout(t *testing.T) {
+	const idle = 300 * time.Millisecond
+	sh := NewShell(makeBinShParams())
+	assert.NoError(t, sh.Start(timeOutShort))
+	// If a check below fails early, the shell's still idle.
+	defer func() { _ = sh.Stop(timeOutShort, "") }()
+
+	// Steady progress runs well past the idle timeout.
+	c := NewRecallCommander(
+		"for i in 1 2 3 4 5 6; do echo $i; sleep 0.1; done")
+	assert.NoError(t, RunWith(sh, timeOutLong, c, WithIdleTimeout(idle)))
+	assert.Len(t, c.DataOut(), 6)
+
+	// Progress on stdErr counts too, as do partial lines.
+	c = NewRecallCommander(
+		"for i in 1 2 3 4 5 6; do printf $i 1>&2; sleep 0.1; done; echo")
+	assert.NoError(t, RunWith(sh, timeOutLong, c, WithIdleTimeout(idle)))
+	assert.Equal(t, []string{"123456"}, c.DataErr())
+
+	// Silence is fatal.
+	err := RunWith(sh, timeOutLong,
+		NewRecallCommander("echo hey; sleep 1"), WithIdleTimeout(idle))
+	assert.ErrorIs(t, err, ErrIdleTimeout)
+	assert.False(t, errors.Is(err, ErrDeadline))
+	assert.Contains(t, err.Error(), `running "echo hey; sleep 1", no output for 300ms`)
+	var te *TimeoutError
+	assert.True(t, errors.As(err, &te))
+}
+
+// plainShell hides every method but those of Shell.
+type plainShell struct{ Shell }
+
+func TestRunWithPlainShell(t *testing.T) {
+	var sh Shell = plainShell{NewShell(makeBinShParams())}
+	assert.NoError(t, sh.Start(timeOutShort))
+	defer func() { assert.NoError(t, sh.Stop(timeOutShort, "")) }()
+	_, ok := sh.(OptionRunner)
+	assert.False(t, ok)
+
+	c := NewRecallCommander("echo hi")
+	assert.Error(t, RunWith(sh, timeOutShort, c, WithIdleTimeout(time.Second)))
+	assert.Empty(t, c.DataOut())
+	assert.NoError(t, RunWith(sh, timeOutShort, c))
+	assert.Equal(t, []string{"hi"}, c.DataOut())
+}
@@ -0,0 +1,38 @@
+//go:build unix
+
+package shexec_test
+
+import (
+	"errors"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/monopole/shexec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunDeadline(t *testing.T) {
+	sh := NewShell(makeBinShParams())
+	assert.NoError(t, sh.Start(timeOutShort))
+	defer func() { _ = sh.Stop(timeOutShort, "") }()
+	c := NewRecallCommander("echo $$")
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	pid, err := strconv.Atoi(c.DataOut()[0])
+	assert.NoError(t, err)
+	// Lots of activity, but too slow overall.
+	err = RunWith(sh,
+		300*time.Millisecond,
+		NewRecallCommander("while true; do echo x; sleep 0.05; done"),
+		WithIdleTimeout(time.Second))
+	assert.ErrorIs(t, err, ErrDeadline)
+	assert.False(t, errors.Is(err, ErrIdleTimeout))
+	assert.Contains(t, err.Error(), "no sentinels found after 300ms")
+
+	// The shell is abandoned, so its process exits.
+	assert.Eventually(t, func() bool {
+		return syscall.Kill(pid, 0) != nil
+	}, timeOutShort, 10*time.Millisecond)
+	assert.Error(t, sh.Run(timeOutShort, c))
+}
@@ -0,0 +1,132 @@
+package scenario
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteText writes a report meant for humans.
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "scenario %q\n", r.Name)
+	if r.Err != nil {
+		fmt.Fprintf(&b, "ERROR shell failed to start; %v\n", r.Err)
+	}
+	var passed, failed, skipped int
+	for _, st := range r.Steps {
+		switch {
+		case st.Skipped:
+			skipped++
+			fmt.Fprintf(&b, "SKIP  %s\n", st.Name)
+			continue
+		case st.Passed():
+			passed++
+			fmt.Fprintf(&b, "PASS  %s (%s)\n", st.Name, st.Duration)
+			continue
+		}
+		failed++
+		fmt.Fprintf(&b, "FAIL  %s (%s)\n", st.Name, st.Duration)
+		fmt.Fprintf(&b, "      command: %s\n", st.Command)
+		if st.Err != nil {
+			fmt.Fprintf(&b, "      error: %v\n", st.Err)
+		}
+		for _, f := range st.Failures {
+			fmt.Fprintf(&b, "      %s\n", f)
+		}
+	}
+	fmt.Fprintf(&b, "%d passed, %d failed, %d skipped in %s\n",
+		passed, failed, skipped, r.Duration)
+	_, err := io.WriteString(w, b.String())
+	return err //nolint:wrapcheck
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     float64     `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the reports as JUnit XML, with a test suite per
+// report, and a test case per step.  Failing to start the shell is
+// reported as an error in a test case named "start".
+func WriteJUnit(w io.Writer, reports ...*Report) error {
+	var suites junitSuites
+	for _, r := range reports {
+		suites.Suites = append(suites.Suites, r.junitSuite())
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err //nolint:wrapcheck
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err //nolint:wrapcheck
+	}
+	_, err := io.WriteString(w, "\n")
+	return err //nolint:wrapcheck
+}
+
+func (r *Report) junitSuite() junitSuite {
+	s := junitSuite{Name: r.Name, Time: r.Duration.Seconds()}
+	if r.Err != nil {
+		s.Errors++
+		s.Cases = append(s.Cases, junitCase{
+			Name: "start", ClassName: r.Name,
+			Error: &junitMessage{Message: r.Err.Error()},
+		})
+	}
+	for _, st := range r.Steps {
+		c := junitCase{
+			Name:      st.Name,
+			ClassName: r.Name,
+			Time:      st.Duration.Seconds(),
+			SystemOut: strings.Join(st.Stdout, "\n"),
+			SystemErr: strings.Join(st.Stderr, "\n"),
+		}
+		switch {
+		case st.Skipped:
+			s.Skipped++
+			c.Skipped = &junitMessage{
+				Message: "shell failed in an earlier step"}
+		case st.Err != nil:
+			s.Errors++
+			c.Error = &junitMessage{Message: st.Err.Error(), Text: st.Command}
+		case len(st.Failures) > 0:
+			s.Failures++
+			c.Failure = &junitMessage{
+				Message: st.Failures[0],
+				Text:    strings.Join(st.Failures, "\n"),
+			}
+		}
+		s.Cases = append(s.Cases, c)
+	}
+	s.Tests = len(s.Cases)
+	return s
+}
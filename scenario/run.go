@@ -0,0 +1,177 @@
+package scenario
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/monopole/shexec"
+	"github.com/monopole/shexec/channeler"
+)
+
+// Report is the outcome of running a Scenario.
+type Report struct {
+	Name string
+	// Err, if not nil, is why the shell couldn't be started.
+	Err      error
+	Steps    []*StepResult
+	Duration time.Duration
+}
+
+// StepResult is the outcome of running a Step.
+type StepResult struct {
+	Name    string
+	Command string
+	// Err is the error, if any, from running the command.
+	Err error
+	// Failures are the unmet expectations.
+	Failures []string
+	// Skipped is true if the step wasn't run, because the shell
+	// failed in an earlier step.
+	Skipped  bool
+	Stdout   []string
+	Stderr   []string
+	Duration time.Duration
+}
+
+// Passed is true if the step ran and met all expectations.
+func (r *StepResult) Passed() bool {
+	return !r.Skipped && r.Err == nil && len(r.Failures) == 0
+}
+
+// redact hides secrets in the text of the result.
+// Err was made by a Shell given the Redactor, so it's hidden already.
+func (r *StepResult) redact(red *channeler.Redactor) {
+	r.Command = red.Redact(r.Command)
+	for _, l := range [][]string{r.Failures, r.Stdout, r.Stderr} {
+		for i := range l {
+			l[i] = red.Redact(l[i])
+		}
+	}
+}
+
+// Passed is true if the shell started and every step passed.
+func (r *Report) Passed() bool {
+	if r.Err != nil {
+		return false
+	}
+	for _, st := range r.Steps {
+		if !st.Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+// Run starts the shell, runs each step in order, and stops the shell.
+// If a step's command fails, the shell is unusable, and all
+// subsequent steps are skipped.
+func (s *Scenario) Run() *Report {
+	start := time.Now()
+	r := &Report{Name: s.Name}
+	defer func() { r.Duration = time.Since(start) }()
+	vars := maps.Clone(s.Vars)
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	red := s.redactor(vars)
+	sh := shexec.NewShell(s.parameters(red))
+	startTimeout := s.Shell.StartTimeout
+	if startTimeout == 0 {
+		startTimeout = defaultTimeout
+	}
+	if r.Err = sh.Start(startTimeout); r.Err != nil {
+		return r
+	}
+	alive := true
+	for i := range s.Steps {
+		st := &s.Steps[i]
+		if !alive {
+			r.Steps = append(r.Steps,
+				&StepResult{Name: st.Name, Skipped: true})
+			continue
+		}
+		res := s.runStep(sh, st, vars)
+		for _, v := range s.Secrets {
+			red.AddValue(vars[v])
+		}
+		res.redact(red)
+		r.Steps = append(r.Steps, res)
+		alive = res.Err == nil
+	}
+	if alive {
+		_ = sh.Stop(startTimeout, "")
+	}
+	return r
+}
+
+func (s *Scenario) runStep(
+	sh shexec.Shell, st *Step, vars map[string]string) *StepResult {
+	res := &StepResult{Name: st.Name}
+	start := time.Now()
+	defer func() { res.Duration = time.Since(start) }()
+	t, err := s.template(st.Name, st.Command)
+	if err == nil {
+		res.Command, err = t.Execute(vars)
+	}
+	if err != nil {
+		// Not a shell problem, so the shell lives on.
+		res.Failures = append(res.Failures, fmt.Sprintf("command; %v", err))
+		return res
+	}
+	c := shexec.NewRecordCommander(res.Command)
+	res.Err = sh.Run(s.timeout(st), c)
+	res.Stdout, res.Stderr = c.DataOut(), c.DataErr()
+	if res.Err != nil {
+		return res
+	}
+	res.Failures = append(res.Failures,
+		st.Stdout.check("stdout", res.Stdout)...)
+	res.Failures = append(res.Failures,
+		st.Stderr.check("stderr", res.Stderr)...)
+	out := strings.Join(res.Stdout, "\n")
+	for _, v := range slices.Sorted(maps.Keys(st.Capture)) {
+		pattern := st.Capture[v]
+		m := regexp.MustCompile(pattern).FindStringSubmatch(out)
+		switch {
+		case m == nil:
+			res.Failures = append(res.Failures,
+				fmt.Sprintf("capture %q; no match for %q", v, pattern))
+		case len(m) > 1:
+			vars[v] = m[1]
+		default:
+			vars[v] = m[0]
+		}
+	}
+	return res
+}
+
+// check returns a description of each unmet expectation.
+func (e *Expect) check(stream string, lines []string) (failures []string) {
+	out := strings.Join(lines, "\n")
+	fail := func(format string, a ...any) {
+		failures = append(failures, stream+"; "+fmt.Sprintf(format, a...))
+	}
+	if e.Exact != nil {
+		if want := strings.TrimSuffix(*e.Exact, "\n"); want != out {
+			fail("expected exactly %q, got %q", want, out)
+		}
+	}
+	for _, c := range e.Contains {
+		if !strings.Contains(out, c) {
+			fail("expected to contain %q", c)
+		}
+	}
+	for _, r := range e.Regex {
+		if !regexp.MustCompile(r).MatchString(out) {
+			fail("expected to match %q", r)
+		}
+	}
+	if e.Lines != nil && *e.Lines != len(lines) {
+		fail("expected %d lines, got %d", *e.Lines, len(lines))
+	}
+	return
+}
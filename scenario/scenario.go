@@ -0,0 +1,226 @@
+// Package scenario runs declarative, YAML-defined command sequences
+// against a shell, checking each command's output.
+package scenario
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/monopole/shexec"
+	"github.com/monopole/shexec/channeler"
+	"github.com/monopole/shexec/quote"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+	defaultShell   = "/bin/sh"
+	sentinelTag    = "scenario_5d2b9a"
+)
+
+// Scenario is a shell, and the steps to run in it.
+type Scenario struct {
+	Name  string `yaml:"name"`
+	Shell Shell  `yaml:"shell"`
+	// Dialect quotes the variables interpolated into commands;
+	// one of "sh" (the default), "bash", "sql", "mysql", "python"
+	// or "none".  Use "mysql", not "sql", for MySQL and MariaDB.
+	Dialect string `yaml:"dialect"`
+	// Timeout is the default timeout of each step.
+	Timeout time.Duration `yaml:"timeout"`
+	// Vars holds initial variable values.
+	Vars map[string]string `yaml:"vars"`
+	// Secrets names the variables, initial or captured, whose values
+	// are secret.  Secrets are hidden from the Report, and from logs
+	// and errors, as are matches for SecretPatterns.
+	Secrets        []string `yaml:"secrets"`
+	SecretPatterns []string `yaml:"secretPatterns"`
+	Steps          []Step   `yaml:"steps"`
+}
+
+// Shell declares the shell to start.  If Path is empty, /bin/sh is
+// used.  If SentinelOut is empty, echo is used for both sentinels,
+// as suits any POSIX shell.  A relative WorkingDir is relative to
+// the directory holding the scenario file.
+type Shell struct {
+	Path         string        `yaml:"path"`
+	Args         []string      `yaml:"args"`
+	WorkingDir   string        `yaml:"workingDir"`
+	SentinelOut  Sentinel      `yaml:"sentinelOut"`
+	SentinelErr  Sentinel      `yaml:"sentinelErr"`
+	StartTimeout time.Duration `yaml:"startTimeout"`
+}
+
+// Sentinel is a shexec.Sentinel.
+type Sentinel struct {
+	Command string `yaml:"command"`
+	Value   string `yaml:"value"`
+}
+
+// Step is a command to run, with expectations about its output.
+type Step struct {
+	Name string `yaml:"name"`
+	// Command is a template (see package quote), which may refer to
+	// variables, e.g. "print bus {{.id}}".
+	Command string        `yaml:"command"`
+	Timeout time.Duration `yaml:"timeout"`
+	Stdout  Expect        `yaml:"stdout"`
+	Stderr  Expect        `yaml:"stderr"`
+	// Capture maps variable names to regexps applied to stdout.
+	// A variable gets the regexp's first group, or if it has no
+	// groups, the whole match.  Failure to match fails the step.
+	Capture map[string]string `yaml:"capture"`
+}
+
+// Expect holds expectations about the output on one stream.
+// Output is the stream's lines, joined by newlines.
+type Expect struct {
+	// Exact, if set, must equal the output, ignoring one
+	// trailing newline.
+	Exact *string `yaml:"exact"`
+	// Contains are substrings the output must contain.
+	Contains []string `yaml:"contains"`
+	// Regex are regexps that must match the output.
+	// Use (?m) for ^ and $ to match at line boundaries.
+	Regex []string `yaml:"regex"`
+	// Lines, if set, is the number of lines there must be.
+	Lines *int `yaml:"lines"`
+}
+
+// Load reads a Scenario from a YAML file.
+func Load(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if wd := s.Shell.WorkingDir; wd != "" && !filepath.IsAbs(wd) {
+		s.Shell.WorkingDir = filepath.Join(filepath.Dir(path), wd)
+	}
+	return s, nil
+}
+
+// Parse reads a Scenario from YAML, and validates it.
+func Parse(data []byte) (*Scenario, error) {
+	var s Scenario
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("scenario; %w", err)
+	}
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("scenario %q; %w", s.Name, err)
+	}
+	return &s, nil
+}
+
+func (s *Scenario) validate() error {
+	if _, err := s.template("check", ""); err != nil {
+		return err
+	}
+	for _, r := range s.SecretPatterns {
+		if _, err := regexp.Compile(r); err != nil {
+			return fmt.Errorf("secret pattern; %w", err)
+		}
+	}
+	for i := range s.Steps {
+		st := &s.Steps[i]
+		if st.Name == "" {
+			st.Name = fmt.Sprintf("step%d", i+1)
+		}
+		if _, err := s.template(st.Name, st.Command); err != nil {
+			return fmt.Errorf("step %q; %w", st.Name, err)
+		}
+		for _, e := range []Expect{st.Stdout, st.Stderr} {
+			for _, r := range e.Regex {
+				if _, err := regexp.Compile(r); err != nil {
+					return fmt.Errorf("step %q; %w", st.Name, err)
+				}
+			}
+		}
+		for v, r := range st.Capture {
+			if _, err := regexp.Compile(r); err != nil {
+				return fmt.Errorf("step %q, capture %q; %w", st.Name, v, err)
+			}
+		}
+	}
+	return nil
+}
+
+// commandTemplate makes commands from variables.
+type commandTemplate interface {
+	Execute(data any) (string, error)
+}
+
+func (s *Scenario) template(name, text string) (commandTemplate, error) {
+	var d quote.Dialect
+	switch s.Dialect {
+	case "", "sh":
+		d = quote.Sh
+	case "bash":
+		d = quote.Bash
+	case "sql":
+		d = quote.SQL
+	case "mysql":
+		d = quote.MySQL
+	case "python":
+		d = quote.Python
+	case "none":
+		return rawTemplate(text), nil
+	default:
+		return nil, fmt.Errorf( //nolint:goerr113
+			"unknown dialect %q", s.Dialect)
+	}
+	//nolint:wrapcheck
+	return quote.NewTemplate(d, name, text)
+}
+
+// rawTemplate is a command used as is.
+type rawTemplate string
+
+func (t rawTemplate) Execute(any) (string, error) { return string(t), nil }
+
+// parameters returns the Parameters for starting the shell.
+func (s *Scenario) parameters(r *channeler.Redactor) shexec.Parameters {
+	path := s.Shell.Path
+	if path == "" {
+		path = defaultShell
+	}
+	p := shexec.NewEchoParameters(sentinelTag, path, s.Shell.Args...)
+	p.WorkingDir = s.Shell.WorkingDir
+	p.Redactor = r
+	if s.Shell.SentinelOut.Command != "" {
+		p.SentinelOut = shexec.Sentinel{
+			C: s.Shell.SentinelOut.Command, V: s.Shell.SentinelOut.Value}
+		p.SentinelErr = shexec.Sentinel{
+			C: s.Shell.SentinelErr.Command, V: s.Shell.SentinelErr.Value}
+	}
+	return p
+}
+
+// redactor returns a Redactor hiding the initial secrets.
+func (s *Scenario) redactor(vars map[string]string) *channeler.Redactor {
+	r := &channeler.Redactor{}
+	for _, p := range s.SecretPatterns {
+		r.AddPattern(regexp.MustCompile(p))
+	}
+	for _, v := range s.Secrets {
+		r.AddValue(vars[v])
+	}
+	return r
+}
+
+func (s *Scenario) timeout(st *Step) time.Duration {
+	switch {
+	case st.Timeout > 0:
+		return st.Timeout
+	case s.Timeout > 0:
+		return s.Timeout
+	default:
+		return defaultTimeout
+	}
+}
@@ -0,0 +1,177 @@
+package scenario_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+
+	. "github.com/monopole/shexec/scenario"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConchScenario(t *testing.T) {
+	s, err := Load("testdata/conch.yaml")
+	if !assert.NoError(t, err) {
+		return
+	}
+	r := s.Run()
+	var b bytes.Buffer
+	assert.NoError(t, r.WriteText(&b))
+	assert.True(t, r.Passed(), b.String())
+	if assert.Len(t, r.Steps, 3) {
+		assert.Equal(t, "print bus 1", r.Steps[1].Command)
+	}
+}
+
+const shScenario = `
+name: sh
+timeout: 1s
+vars:
+  who: O'Brien
+steps:
+  - command: echo hello {{.who}}
+    stdout:
+      exact: "hello O'Brien\n"
+    capture:
+      greeting: '^(\w+)'
+  - name: blankLinesCount
+    command: printf '{{raw .greeting}}\n\nthere\n'
+    stdout:
+      lines: 3
+      contains: [there, nowhere]
+      regex: ['^hello$', '(?m)^there$']
+  - name: die
+    command: exit 3
+  - name: never
+    command: echo never
+`
+
+func TestShScenario(t *testing.T) {
+	s, err := Parse([]byte(shScenario))
+	if !assert.NoError(t, err) {
+		return
+	}
+	r := s.Run()
+	assert.NoError(t, r.Err)
+	assert.False(t, r.Passed())
+	if !assert.Len(t, r.Steps, 4) {
+		return
+	}
+	assert.Equal(t, "step1", r.Steps[0].Name)
+	assert.Equal(t, `echo hello 'O'\''Brien'`, r.Steps[0].Command)
+	assert.True(t, r.Steps[0].Passed(), r.Steps[0].Failures)
+	assert.Equal(t, []string{"hello", "", "there"}, r.Steps[1].Stdout)
+	assert.Equal(t, []string{
+		`stdout; expected to contain "nowhere"`,
+		`stdout; expected to match "^hello$"`,
+	}, r.Steps[1].Failures)
+	assert.Error(t, r.Steps[2].Err)
+	assert.True(t, r.Steps[3].Skipped)
+
+	var b bytes.Buffer
+	assert.NoError(t, r.WriteText(&b))
+	assert.Contains(t, b.String(), "PASS  step1")
+	assert.Contains(t, b.String(), "FAIL  blankLinesCount")
+	assert.Contains(t, b.String(), "SKIP  never")
+	assert.Contains(t, b.String(), "1 passed, 2 failed, 1 skipped")
+
+	b.Reset()
+	assert.NoError(t, WriteJUnit(&b, r))
+	var doc struct {
+		Suites []struct {
+			Name     string `xml:"name,attr"`
+			Tests    int    `xml:"tests,attr"`
+			Failures int    `xml:"failures,attr"`
+			Errors   int    `xml:"errors,attr"`
+			Skipped  int    `xml:"skipped,attr"`
+		} `xml:"testsuite"`
+	}
+	assert.NoError(t, xml.Unmarshal(b.Bytes(), &doc))
+	if assert.Len(t, doc.Suites, 1) {
+		su := doc.Suites[0]
+		assert.Equal(t, "sh", su.Name)
+		assert.Equal(t, 4, su.Tests)
+		assert.Equal(t, 1, su.Failures)
+		assert.Equal(t, 1, su.Errors)
+		assert.Equal(t, 1, su.Skipped)
+	}
+}
+
+const secretScenario = `
+name: secret
+timeout: 1s
+vars:
+  password: pa55word
+secrets: [password, token]
+secretPatterns: ['key-\w+']
+steps:
+  - command: echo {{.password}} key-abc
+    stdout:
+      exact: "nope"
+  - command: echo token 7e3f91
+    capture:
+      token: 'token (\w+)'
+  - command: echo the token is 7e3f91
+`
+
+func TestSecretScenario(t *testing.T) {
+	s, err := Parse([]byte(secretScenario))
+	if !assert.NoError(t, err) {
+		return
+	}
+	r := s.Run()
+	if !assert.Len(t, r.Steps, 3) {
+		return
+	}
+	assert.Equal(t, "echo [REDACTED] [REDACTED]", r.Steps[0].Command)
+	assert.Equal(t, []string{"[REDACTED] [REDACTED]"}, r.Steps[0].Stdout)
+	assert.Equal(t, []string{
+		`stdout; expected exactly "nope", got "[REDACTED] [REDACTED]"`,
+	}, r.Steps[0].Failures)
+	// A captured secret is hidden from its step on.
+	assert.Equal(t, []string{"token [REDACTED]"}, r.Steps[1].Stdout)
+	assert.Equal(t, []string{"the token is [REDACTED]"}, r.Steps[2].Stdout)
+	assert.True(t, r.Steps[2].Passed())
+
+	var b bytes.Buffer
+	assert.NoError(t, r.WriteText(&b))
+	assert.NotContains(t, b.String(), "pa55word")
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := map[string]struct {
+		yaml     string
+		expected string
+	}{
+		"badYaml": {
+			yaml:     "steps: [",
+			expected: "scenario; yaml",
+		},
+		"badDialect": {
+			yaml:     "dialect: cobol",
+			expected: `unknown dialect "cobol"`,
+		},
+		"badTemplate": {
+			yaml:     "steps: [{command: 'echo {{.x'}]",
+			expected: `step "step1"`,
+		},
+		"badRegex": {
+			yaml:     "steps: [{command: ls, stdout: {regex: ['(']}}]",
+			expected: "missing closing )",
+		},
+		"badSecretPattern": {
+			yaml:     "secretPatterns: ['(']",
+			expected: "secret pattern",
+		},
+		"badCapture": {
+			yaml:     "steps: [{command: ls, capture: {x: '['}}]",
+			expected: `capture "x"`,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			_, err := Parse([]byte(tc.yaml))
+			assert.ErrorContains(t, err, tc.expected)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package shexec
+
+import "github.com/monopole/shexec/channeler"
+
+// Sensitive is an optional extension of Commander, for a command
+// holding a secret, e.g. one setting a password.
+//
+// If Sensitive returns true, the command is hidden, while Run runs it,
+// from the Shell's log lines and error messages, just as the secrets
+// of the Shell's channeler.Redactor are.  To hide a secret that's only
+// part of a command, or that shows up in output, use a Redactor (see
+// channeler.Params.Redactor).
+//
+// Errors from a Parser made by AsParser are hidden too, even after Run
+// returns, so RunT's are safe.  Those got by calling a Commander's own
+// result method, e.g. RecallCommander.Result, aren't; a StdErrError
+// names the command it came from.
+type Sensitive interface {
+	Sensitive() bool
+}
+
+// SensitiveCommander marks a Commander as sensitive.
+// The wrapped Commander's other extensions still apply.
+type SensitiveCommander struct {
+	Commander
+}
+
+func (c *SensitiveCommander) Sensitive() bool   { return true }
+func (c *SensitiveCommander) Unwrap() Commander { return c.Commander }
+
+// engageSensitive hides the command from the Shell's logs and errors
+// if the Commander is sensitive, until the returned function is called.
+func (eInf *execInfra) engageSensitive(c Commander) (disengage func()) {
+	s, ok := extension[Sensitive](c)
+	if !ok || !s.Sensitive() {
+		return func() {}
+	}
+	r := &channeler.Redactor{}
+	r.AddValue(c.Command())
+	return eInf.red.Include(r)
+}
+
+// resultRedactor returns a Redactor hiding the Shell's secrets, and
+// the command if it's sensitive, even after Run returns.
+func (eInf *execInfra) resultRedactor(c Commander) *channeler.Redactor {
+	r := &channeler.Redactor{}
+	r.Include(eInf.red)
+	if s, ok := extension[Sensitive](c); ok && s.Sensitive() {
+		r.AddValue(c.Command())
+	}
+	return r
+}
@@ -0,0 +1,95 @@
+package shexec_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/monopole/shexec"
+	"github.com/monopole/shexec/channeler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSensitiveCommander(t *testing.T) {
+	const secret = "s3cr3t_7f4e2a"
+	p := makeBinShParams()
+	p.Policy = &Policy{
+		Rules: []PolicyRule{{Action: PolicyDeny, Argv: []string{"login"}}},
+	}
+	sh := NewShell(p)
+	assert.NoError(t, sh.Start(timeOutShort))
+
+	// The command is hidden only while it runs.
+	err := sh.Run(timeOutShort, &SensitiveCommander{
+		Commander: NewRecallCommander("login " + secret)})
+	var pe *PolicyError
+	if assert.True(t, errors.As(err, &pe)) {
+		assert.Equal(t, channeler.Redacted, pe.Command)
+	}
+	assert.NotContains(t, err.Error(), secret)
+
+	rc := NewRecallCommander("echo " + secret)
+	assert.NoError(t, sh.Run(timeOutShort, &SensitiveCommander{Commander: rc}))
+	assert.Equal(t, []string{secret}, rc.DataOut())
+
+	// The wrapped Commander's extensions still apply.
+	err = sh.Run(timeOutShort, &SensitiveCommander{
+		Commander: &limitedCommander{
+			RecallCommander: NewRecallCommander("seq 1 10; echo " + secret),
+			limits:          OutputLimits{MaxLines: 2},
+		}})
+	var te *TruncationError
+	if assert.True(t, errors.As(err, &te)) {
+		assert.Equal(t, channeler.Redacted, te.Command)
+	}
+	assert.NotContains(t, err.Error(), secret)
+
+	// A parser's error is hidden, though made after Run returns.
+	rc = NewRecallCommander("echo oops 1>&2; : " + secret)
+	_, err = RunT(sh, timeOutShort,
+		AsParser(&SensitiveCommander{Commander: rc}, rc.Result))
+	var se *StdErrError
+	assert.False(t, errors.As(err, &se))
+	assert.EqualError(t, err, `"[REDACTED]" wrote to stdErr: oops`)
+
+	// Once the command is done, it's no longer hidden.
+	err = sh.Run(timeOutShort, NewRecallCommander("login "+secret))
+	assert.ErrorContains(t, err, secret)
+	assert.NoError(t, sh.Stop(timeOutShort, ""))
+}
+
+func TestRedactorParameter(t *testing.T) {
+	const secret = "s3cr3t_9b1c0d"
+	p := makeBinShParams()
+	r := &channeler.Redactor{}
+	r.AddValue(secret)
+	p.Redactor = r
+	p.Policy = &Policy{
+		Rules: []PolicyRule{{Action: PolicyDeny, Argv: []string{"login"}}},
+	}
+	sh := NewShell(p)
+	assert.NoError(t, sh.Start(timeOutShort))
+
+	err := sh.Run(timeOutShort, NewRecallCommander("login -p "+secret))
+	assert.ErrorContains(t, err, "login -p [REDACTED]")
+
+	// Another shell's errors aren't affected.
+	p.Redactor = nil
+	other := NewShell(p)
+	assert.NoError(t, other.Start(timeOutShort))
+	err = other.Run(timeOutShort, NewRecallCommander("login -p "+secret))
+	assert.ErrorContains(t, err, "login -p "+secret)
+	assert.NoError(t, other.Stop(timeOutShort, ""))
+
+	// Secrets added later are hidden, too.
+	const later = "s3cr3t_5e6f7a"
+	r.AddValue(later)
+	err = sh.Run(timeOutShort, NewRecallCommander("login -p "+later))
+	assert.ErrorContains(t, err, "login -p [REDACTED]")
+
+	// Output isn't redacted.
+	rc := NewRecallCommander("echo " + secret)
+	assert.NoError(t, sh.Run(timeOutShort, rc))
+	assert.Equal(t, []string{secret}, rc.DataOut())
+
+	assert.NoError(t, sh.Stop(timeOutShort, ""))
+}
@@ -0,0 +1,359 @@
+// Package server serves named, long-lived shell sessions over HTTP,
+// so that programs not written in Go can share them.
+//
+// Requests and responses are JSON:
+//
+//	POST   /sessions               create a session from a SessionSpec
+//	GET    /sessions               list the session names
+//	POST   /sessions/{name}/run    run a RunRequest, returning a RunResult
+//	POST   /sessions/{name}/stream run a RunRequest, streaming its output
+//	DELETE /sessions/{name}        stop the session
+//
+// Every request must carry the Handler's token, as in
+//
+//	Authorization: Bearer <token>
+//
+// and request bodies must be sent as application/json.  If the
+// Handler was given hosts, the Host header must name one of them,
+// which defeats DNS rebinding.  Together these keep web pages the
+// user visits from reaching the shells.
+//
+// The stream endpoint sends Server-Sent Events: a "line" event with
+// a StreamedLine for each line of output, then a "done" event with
+// a RunResult lacking the lines.
+//
+// Each session is a shexec.Shell, so runs of one session happen one
+// at a time, in the order requested, while different sessions run
+// independently.  A session whose shell dies stays listed, failing
+// every run, until it's deleted.
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/monopole/shexec"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+	defaultShell   = "/bin/sh"
+	sentinelTag    = "server_3c8e41"
+	// maxBodyBytes bounds request bodies.
+	maxBodyBytes = 1 << 20
+	// tokenBytes is the number of random bytes in a NewToken.
+	tokenBytes = 32
+)
+
+// SessionSpec declares a session to create.  If Path is empty,
+// /bin/sh is used.  If SentinelOut is empty, echo is used for both
+// sentinels, as suits any POSIX shell.  Durations are strings like
+// "10s"; empty means ten seconds.
+type SessionSpec struct {
+	Name         string   `json:"name"`
+	Path         string   `json:"path"`
+	Args         []string `json:"args"`
+	WorkingDir   string   `json:"workingDir"`
+	SentinelOut  Sentinel `json:"sentinelOut"`
+	SentinelErr  Sentinel `json:"sentinelErr"`
+	StartTimeout string   `json:"startTimeout"`
+	StopTimeout  string   `json:"stopTimeout"`
+}
+
+// Sentinel is a shexec.Sentinel.
+type Sentinel struct {
+	Command string `json:"command"`
+	Value   string `json:"value"`
+}
+
+// RunRequest is a command to run in a session.
+type RunRequest struct {
+	Command string `json:"command"`
+	Timeout string `json:"timeout"`
+}
+
+// RunResult is the outcome of running a command.  If Error is not
+// empty, the output may be incomplete, and unless Truncated is true,
+// the session's shell has died.
+type RunResult struct {
+	Stdout    []string `json:"stdout,omitempty"`
+	Stderr    []string `json:"stderr,omitempty"`
+	Error     string   `json:"error,omitempty"`
+	Truncated bool     `json:"truncated,omitempty"`
+}
+
+// errorResponse is the body of a failed request.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// session is a named shell.
+type session struct {
+	name        string
+	shell       shexec.Shell
+	stopTimeout time.Duration
+}
+
+// Handler serves shell sessions.
+type Handler struct {
+	mux      *http.ServeMux
+	token    string
+	hosts    []string
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// NewHandler returns a Handler without sessions, serving requests
+// that carry the token.  An empty token refuses every request.
+// If hosts are given, requests must also name one of them, e.g.
+// "localhost:7070", in the Host header.
+func NewHandler(token string, hosts ...string) *Handler {
+	h := &Handler{
+		mux:      http.NewServeMux(),
+		token:    token,
+		hosts:    hosts,
+		sessions: make(map[string]*session),
+	}
+	h.mux.HandleFunc("POST /sessions", h.create)
+	h.mux.HandleFunc("GET /sessions", h.list)
+	h.mux.HandleFunc("POST /sessions/{name}/run", h.run)
+	h.mux.HandleFunc("POST /sessions/{name}/stream", h.stream)
+	h.mux.HandleFunc("DELETE /sessions/{name}", h.remove)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.knownHost(r) {
+		writeError(w, http.StatusForbidden, "unknown host %q", r.Host)
+		return
+	}
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "missing or wrong token")
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// knownHost is true if the request names one of the hosts,
+// or there are none.
+func (h *Handler) knownHost(r *http.Request) bool {
+	return len(h.hosts) == 0 || slices.ContainsFunc(h.hosts,
+		func(host string) bool { return strings.EqualFold(host, r.Host) })
+}
+
+// authorized is true if the request carries the token.
+func (h *Handler) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && h.token != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+// NewToken returns a random token for NewHandler.
+func NewToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Close stops all sessions, returning the errors from doing so.
+func (h *Handler) Close() error {
+	h.mu.Lock()
+	all := h.sessions
+	h.sessions = make(map[string]*session)
+	h.mu.Unlock()
+	var errs []error
+	for _, s := range all {
+		if err := s.shell.Stop(s.stopTimeout, ""); err != nil {
+			errs = append(errs, fmt.Errorf("session %q; %w", s.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	var spec SessionSpec
+	if !decode(w, r, &spec) {
+		return
+	}
+	if spec.Name == "" {
+		writeError(w, http.StatusBadRequest, "session needs a name")
+		return
+	}
+	startTimeout, err := parseDuration(spec.StartTimeout)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "startTimeout; %v", err)
+		return
+	}
+	stopTimeout, err := parseDuration(spec.StopTimeout)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "stopTimeout; %v", err)
+		return
+	}
+	s := &session{
+		name:        spec.Name,
+		shell:       shexec.NewShell(spec.parameters()),
+		stopTimeout: stopTimeout,
+	}
+	// Reserve the name while the shell starts.
+	h.mu.Lock()
+	_, taken := h.sessions[s.name]
+	if !taken {
+		h.sessions[s.name] = s
+	}
+	h.mu.Unlock()
+	if taken {
+		writeError(w, http.StatusConflict, "session %q exists", s.name)
+		return
+	}
+	if err = s.shell.Start(startTimeout); err != nil {
+		h.mu.Lock()
+		delete(h.sessions, s.name)
+		h.mu.Unlock()
+		writeError(w, http.StatusBadGateway, "starting %q; %v", s.name, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"name": s.name})
+}
+
+func (h *Handler) list(w http.ResponseWriter, _ *http.Request) {
+	h.mu.Lock()
+	names := make([]string, 0, len(h.sessions))
+	for n := range h.sessions {
+		names = append(names, n)
+	}
+	h.mu.Unlock()
+	slices.Sort(names)
+	writeJSON(w, http.StatusOK, map[string][]string{"sessions": names})
+}
+
+func (h *Handler) run(w http.ResponseWriter, r *http.Request) {
+	s, req, timeout, ok := h.runRequest(w, r)
+	if !ok {
+		return
+	}
+	c := shexec.NewRecordCommander(req.Command)
+	err := s.shell.Run(timeout, c)
+	res := result(err)
+	res.Stdout, res.Stderr = c.DataOut(), c.DataErr()
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h *Handler) remove(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	h.mu.Lock()
+	s, ok := h.sessions[name]
+	delete(h.sessions, name)
+	h.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "no session %q", name)
+		return
+	}
+	if err := s.shell.Stop(s.stopTimeout, ""); err != nil {
+		writeError(w, http.StatusBadGateway, "stopping %q; %v", name, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runRequest finds the session, and decodes the RunRequest.
+// If there's a problem, it's reported and ok is false.
+func (h *Handler) runRequest(w http.ResponseWriter, r *http.Request) (
+	s *session, req RunRequest, timeout time.Duration, ok bool) {
+	name := r.PathValue("name")
+	h.mu.Lock()
+	s, ok = h.sessions[name]
+	h.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "no session %q", name)
+		return
+	}
+	if ok = decode(w, r, &req); !ok {
+		return
+	}
+	var err error
+	if timeout, err = parseDuration(req.Timeout); err != nil {
+		writeError(w, http.StatusBadRequest, "timeout; %v", err)
+		return s, req, 0, false
+	}
+	return s, req, timeout, true
+}
+
+// result makes a RunResult from the error returned by Run.
+func result(err error) RunResult {
+	var res RunResult
+	if err != nil {
+		res.Error = err.Error()
+		var te *shexec.TruncationError
+		res.Truncated = errors.As(err, &te)
+	}
+	return res
+}
+
+// parameters returns the Parameters for starting the session's shell.
+func (spec *SessionSpec) parameters() shexec.Parameters {
+	path := spec.Path
+	if path == "" {
+		path = defaultShell
+	}
+	p := shexec.NewEchoParameters(sentinelTag, path, spec.Args...)
+	p.WorkingDir = spec.WorkingDir
+	if spec.SentinelOut.Command != "" {
+		p.SentinelOut = shexec.Sentinel{
+			C: spec.SentinelOut.Command, V: spec.SentinelOut.Value}
+		p.SentinelErr = shexec.Sentinel{
+			C: spec.SentinelErr.Command, V: spec.SentinelErr.Value}
+	}
+	return p
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return defaultTimeout, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("%q isn't positive", s) //nolint:goerr113
+	}
+	return d, err //nolint:wrapcheck
+}
+
+// decode reads a JSON request body.
+// If there's a problem, it's reported and false is returned.
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mt != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType,
+			"request body must be application/json")
+		return false
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "bad request body; %v", err)
+		return false
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, code int, format string, a ...any) {
+	writeJSON(w, code, errorResponse{Error: fmt.Sprintf(format, a...)})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,200 @@
+package server_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/monopole/shexec/server"
+	"github.com/stretchr/testify/assert"
+)
+
+const token = "s3cret"
+
+func request(t *testing.T, srv *httptest.Server,
+	method, path, body string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req
+}
+
+func call(t *testing.T, srv *httptest.Server,
+	method, path, body string, result any) int {
+	t.Helper()
+	return do(t, srv, request(t, srv, method, path, body), result)
+}
+
+func do(t *testing.T, srv *httptest.Server, req *http.Request, result any) int {
+	t.Helper()
+	resp, err := srv.Client().Do(req)
+	if !assert.NoError(t, err) {
+		return 0
+	}
+	defer resp.Body.Close()
+	if result != nil {
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+	}
+	return resp.StatusCode
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+func TestSessions(t *testing.T) {
+	h := NewHandler(token)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	assert.Equal(t, http.StatusCreated,
+		call(t, srv, "POST", "/sessions", `{"name": "a"}`, nil))
+	assert.Equal(t, http.StatusCreated, call(t, srv, "POST", "/sessions",
+		`{"name": "b", "args": ["-c", "cd /; exec /bin/sh"]}`, nil))
+	var eb errorBody
+	assert.Equal(t, http.StatusConflict,
+		call(t, srv, "POST", "/sessions", `{"name": "a"}`, &eb))
+	assert.Contains(t, eb.Error, `session "a" exists`)
+
+	var list struct{ Sessions []string }
+	assert.Equal(t, http.StatusOK, call(t, srv, "GET", "/sessions", "", &list))
+	assert.Equal(t, []string{"a", "b"}, list.Sessions)
+
+	// Sessions are long-lived, and independent.
+	var res RunResult
+	assert.Equal(t, http.StatusOK, call(t, srv, "POST", "/sessions/a/run",
+		`{"command": "cd /tmp; x=42"}`, &res))
+	assert.Equal(t, RunResult{}, res)
+	assert.Equal(t, http.StatusOK, call(t, srv, "POST", "/sessions/a/run",
+		`{"command": "echo $x; pwd; ls /nope"}`, &res))
+	assert.Equal(t, []string{"42", "/tmp"}, res.Stdout)
+	if assert.Len(t, res.Stderr, 1) {
+		assert.Contains(t, res.Stderr[0], "/nope")
+	}
+	res = RunResult{}
+	assert.Equal(t, http.StatusOK, call(t, srv, "POST", "/sessions/b/run",
+		`{"command": "echo $x; pwd"}`, &res))
+	assert.Equal(t, []string{"", "/"}, res.Stdout)
+
+	res = RunResult{}
+	assert.Equal(t, http.StatusOK, call(t, srv, "POST", "/sessions/b/run",
+		`{"command": "sleep 1", "timeout": "50ms"}`, &res))
+	assert.Contains(t, res.Error, "no sentinels found after 50ms")
+	assert.False(t, res.Truncated)
+
+	assert.Equal(t, http.StatusNotFound,
+		call(t, srv, "POST", "/sessions/c/run", `{"command": "ls"}`, nil))
+	assert.Equal(t, http.StatusBadRequest,
+		call(t, srv, "POST", "/sessions/a/run", `{"cmd": "ls"}`, nil))
+	assert.Equal(t, http.StatusBadRequest, call(t, srv, "POST",
+		"/sessions/a/run", `{"command": "ls", "timeout": "soon"}`, nil))
+	assert.Equal(t, http.StatusBadGateway, call(t, srv, "POST", "/sessions",
+		`{"name": "c", "path": "/nonexistent/shell"}`, nil))
+
+	assert.Equal(t, http.StatusNoContent,
+		call(t, srv, "DELETE", "/sessions/a", "", nil))
+	assert.Equal(t, http.StatusNotFound,
+		call(t, srv, "DELETE", "/sessions/a", "", nil))
+	assert.Equal(t, http.StatusOK, call(t, srv, "GET", "/sessions", "", &list))
+	assert.Equal(t, []string{"b"}, list.Sessions)
+	// Session b died of its timeout, so can't be stopped.
+	assert.Error(t, h.Close())
+}
+
+func TestStream(t *testing.T) {
+	h := NewHandler(token)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	assert.Equal(t, http.StatusCreated,
+		call(t, srv, "POST", "/sessions", `{"name": "a"}`, nil))
+
+	resp, err := srv.Client().Do(request(t, srv, "POST", "/sessions/a/stream",
+		`{"command": "echo a; sleep 0.05; echo b 1>&2"}`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	var (
+		events []string
+		lines  []StreamedLine
+		done   RunResult
+	)
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		if event, ok := strings.CutPrefix(sc.Text(), "event: "); ok {
+			events = append(events, event)
+			continue
+		}
+		data, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if events[len(events)-1] == "done" {
+			assert.NoError(t, json.Unmarshal([]byte(data), &done))
+			continue
+		}
+		var l StreamedLine
+		assert.NoError(t, json.Unmarshal([]byte(data), &l))
+		lines = append(lines, l)
+	}
+	assert.Equal(t, []string{"line", "line", "done"}, events)
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, "stdout", lines[0].Stream)
+		assert.Equal(t, "a", lines[0].Text)
+		assert.Equal(t, "stderr", lines[1].Stream)
+		assert.Equal(t, "b", lines[1].Text)
+		assert.Less(t, lines[0].Seq, lines[1].Seq)
+	}
+	assert.Equal(t, RunResult{}, done)
+	assert.NoError(t, h.Close())
+}
+
+func TestGuard(t *testing.T) {
+	const body = `{"name": "a"}`
+	var eb errorBody
+
+	// The Host header must be known.
+	srv := httptest.NewServer(NewHandler(token, "example.com:80"))
+	assert.Equal(t, http.StatusForbidden,
+		call(t, srv, "POST", "/sessions", body, &eb))
+	assert.Contains(t, eb.Error, "unknown host")
+	srv.Close()
+
+	// An empty token refuses everything.
+	srv = httptest.NewServer(NewHandler(""))
+	req := request(t, srv, "GET", "/sessions", "")
+	req.Header.Set("Authorization", "Bearer ")
+	assert.Equal(t, http.StatusUnauthorized, do(t, srv, req, nil))
+	srv.Close()
+
+	srv = httptest.NewUnstartedServer(nil)
+	h := NewHandler(token, srv.Listener.Addr().String())
+	srv.Config.Handler = h
+	srv.Start()
+	defer srv.Close()
+
+	// The token must be right.
+	req = request(t, srv, "POST", "/sessions", body)
+	req.Header.Del("Authorization")
+	assert.Equal(t, http.StatusUnauthorized, do(t, srv, req, nil))
+	req = request(t, srv, "POST", "/sessions", body)
+	req.Header.Set("Authorization", "Bearer "+token+"x")
+	assert.Equal(t, http.StatusUnauthorized, do(t, srv, req, nil))
+
+	// A body must be JSON, which a cross-site form can't send.
+	req = request(t, srv, "POST", "/sessions", body)
+	req.Header.Set("Content-Type", "text/plain")
+	assert.Equal(t, http.StatusUnsupportedMediaType, do(t, srv, req, nil))
+	req = request(t, srv, "POST", "/sessions", body)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	assert.Equal(t, http.StatusCreated, do(t, srv, req, nil))
+	assert.NoError(t, h.Close())
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/monopole/shexec/channeler"
+)
+
+// StreamedLine is a line of output sent by the stream endpoint.
+type StreamedLine struct {
+	// Stream is "stdout" or "stderr".
+	Stream string `json:"stream"`
+	Text   string `json:"text"`
+	// Seq orders lines across both streams.
+	Seq uint64 `json:"seq"`
+}
+
+func (h *Handler) stream(w http.ResponseWriter, r *http.Request) {
+	s, req, timeout, ok := h.runRequest(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	// The scans end before Run returns, so es isn't used after this
+	// handler returns, as the ResponseWriter mustn't be.
+	es := &eventSender{w: w, flusher: flusher}
+	c := &streamCommander{c: req.Command}
+	c.out = lineSender{es: es, stream: "stdout"}
+	c.err = lineSender{es: es, stream: "stderr"}
+	err := s.shell.Run(timeout, c)
+	es.send("done", result(err))
+}
+
+// eventSender sends Server-Sent Events.  Lines arrive from the
+// goroutines scanning stdOut and stdErr, so sending is serialized.
+type eventSender struct {
+	mu      sync.Mutex
+	w       io.Writer
+	flusher http.Flusher
+}
+
+func (es *eventSender) send(event string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		// Not possible with the types sent.
+		panic(err)
+	}
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	// A client that's gone away can't be helped; the run continues.
+	_, _ = fmt.Fprintf(es.w, "event: %s\ndata: %s\n\n", event, data)
+	es.flusher.Flush()
+}
+
+// streamCommander sends each line of output as an event.
+type streamCommander struct {
+	c        string
+	out, err lineSender
+}
+
+func (c *streamCommander) Command() string          { return c.c }
+func (c *streamCommander) ParseOut() io.WriteCloser { return &c.out }
+func (c *streamCommander) ParseErr() io.WriteCloser { return &c.err }
+
+// lineSender sends the lines of one stream as events.
+type lineSender struct {
+	es     *eventSender
+	stream string
+}
+
+func (ls *lineSender) Write(data []byte) (int, error) {
+	return len(data), ls.WriteLine(channeler.Line{Text: data})
+}
+
+func (ls *lineSender) WriteLine(line channeler.Line) error {
+	ls.es.send("line", StreamedLine{
+		Stream: ls.stream, Text: string(line.Text), Seq: line.Seq})
+	return nil
+}
+
+func (ls *lineSender) Close() error { return nil }
@@ -41,11 +41,24 @@ type Shell interface {
 	// command timed out because no sentinels were detected
 	// in the time given.
 	// An error here means that the shell is dead, and in
-	// need of fresh call to Start.
+	// need of fresh call to Start, unless the error is a
+	// *TruncationError, a *PolicyError or a *BinaryError.
+	// A dead shell's process is interrupted, and its stdIn
+	// closed, so that it exits.
 	// Errors:
 	// * The shell hasn't been started.
 	// * The command timed out.
 	// * The shell exited, regardless of exit code.
+	// * The command's output exceeded its OutputLimits
+	//   (a *TruncationError, or two joined if both streams were
+	//   truncated; the shell remains usable).
+	// * The Parameters' Policy rejected the command
+	//   (a *PolicyError; the command wasn't sent).
+	// * The Commander wants binary output that can't be had
+	//   (a *BinaryError; the command wasn't sent).
+	// * The command's output stopped for longer than allowed
+	//   by WithIdleTimeout (see RunWith).
+	// Timeouts are reported as a *TimeoutError.
 	Run(time.Duration, Commander) error
 
 	// Stop attempts to gracefully stop the shell.
@@ -139,13 +139,15 @@ const (
 	rawExit     = "that's all folks"
 )
 
-func rawSetUp() (chan string, chan error, chan string, chan string, Shell) {
+func rawSetUp() (
+	chan string, chan error, chan *channeler.Chunk, chan *channeler.Chunk,
+	Shell) {
 	// Intentionally use no-buffer channels,
 	// so that all traffic is accounted for.
 	chStdIn := make(chan string)
 	chDone := make(chan error)
-	chStdOut := make(chan string)
-	chStdErr := make(chan string)
+	chStdOut := make(chan *channeler.Chunk)
+	chStdErr := make(chan *channeler.Chunk)
 	// Return the bare channels for manipulation in test.
 	return chStdIn, chDone, chStdOut, chStdErr,
 		NewShellRaw(
@@ -177,8 +179,8 @@ func TestShellRaw1(t *testing.T) {
 		close(chDone)
 	}()
 	// Send the expected sentinel values.
-	go func() { chStdErr <- rawSentErrV }()
-	go func() { chStdOut <- rawSentOutV }()
+	go func() { chStdErr <- channeler.NewChunk(rawSentErrV) }()
+	go func() { chStdOut <- channeler.NewChunk(rawSentOutV) }()
 	// Start it.
 	assert.NoError(t, sh.Start(timeOutTiny))
 	// Stop it.
@@ -195,7 +197,7 @@ func TestShellRaw2(t *testing.T) {
 		assert.False(t, stillOpen)
 		close(chDone)
 	}()
-	go func() { chStdErr <- rawSentErrV }()
+	go func() { chStdErr <- channeler.NewChunk(rawSentErrV) }()
 	// Send nothing on stdOut (no sentinel value).
 	err := sh.Start(timeOutTiny)
 	assert.Error(t, err)
@@ -223,14 +225,40 @@ func TestShellRaw3(t *testing.T) {
 		close(chDone)
 	}()
 	go func() {
-		chStdErr <- rawSentErrV
-		chStdErr <- rawSentErrV
+		chStdErr <- channeler.NewChunk(rawSentErrV)
+		chStdErr <- channeler.NewChunk(rawSentErrV)
 	}()
 	go func() {
-		chStdOut <- rawSentOutV
-		chStdOut <- rawSentOutV
+		chStdOut <- channeler.NewChunk(rawSentOutV)
+		chStdOut <- channeler.NewChunk(rawSentOutV)
 	}()
 	assert.NoError(t, sh.Start(timeOutTiny))
 	assert.NoError(t, sh.Run(timeOutTiny, &sillyCommand{}))
 	assert.NoError(t, sh.Stop(timeOutTiny, rawExit))
 }
+
+// Lines that follow a sentinel in the same chunk belong to the next Run.
+func TestShellRawChunkSpansRuns(t *testing.T) {
+	chStdIn, chDone, chStdOut, chStdErr, sh := rawSetUp()
+	go func() {
+		for i := 0; i < 6; i++ {
+			<-chStdIn
+		}
+		_, stillOpen := <-chStdIn
+		assert.False(t, stillOpen)
+		close(chDone)
+	}()
+	go func() {
+		chStdErr <- channeler.NewChunk(rawSentErrV, rawSentErrV)
+	}()
+	go func() {
+		chStdOut <- channeler.NewChunk(rawSentOutV, "alpha", "beta")
+		chStdOut <- channeler.NewChunk("gamma", rawSentOutV)
+	}()
+	assert.NoError(t, sh.Start(timeOutTiny))
+	c := NewRecallCommander(rawCommand)
+	assert.NoError(t, sh.Run(timeOutTiny, c))
+	assert.Equal(t, []string{"alpha", "beta", "gamma"}, c.DataOut())
+	assert.Empty(t, c.DataErr())
+	assert.NoError(t, sh.Stop(timeOutTiny, rawExit))
+}
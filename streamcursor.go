@@ -0,0 +1,113 @@
+package shexec
+
+import (
+	"github.com/monopole/shexec/channeler"
+)
+
+// streamCursor reads lines from a channel of Chunks.
+// It remembers its place in the current Chunk, so that lines
+// following a sentinel remain available to the next scan.
+type streamCursor struct {
+	name  string
+	lgr   *shLogger
+	ch    <-chan *channeler.Chunk
+	chunk *channeler.Chunk
+	next  int
+	// lastSeq is the sequence number of the last line returned.
+	lastSeq uint64
+	// boundary is true if nextLine last stopped at a boundary.
+	boundary bool
+	// quit, when closed, makes nextLine stop awaiting a Chunk.
+	quit <-chan struct{}
+	// chActivity gets a signal, if it has room for one,
+	// whenever a Chunk arrives.
+	chActivity chan<- struct{}
+}
+
+func newStreamCursor(
+	name string, ch <-chan *channeler.Chunk,
+	chActivity chan<- struct{}, lgr *shLogger) *streamCursor {
+	return &streamCursor{
+		name: name, lgr: lgr, ch: ch, chActivity: chActivity}
+}
+
+// nextLine returns the next line from the stream, or false if
+// the stream has closed, quit has closed, or a boundary has been
+// reached, the latter noted for takeBoundary.  The line's text is
+// only valid until the following call to nextLine.  If ds is not
+// nil, it's shown each line, and each partial line, as it arrives.
+func (sc *streamCursor) nextLine(ds *dialogSide) (channeler.Line, bool) {
+	for sc.chunk == nil || sc.next >= sc.chunk.Len() {
+		if sc.chunk != nil {
+			if ds != nil {
+				ds.partial(sc.chunk.Partial())
+			}
+			boundary := sc.chunk.Boundary()
+			sc.chunk.Release()
+			sc.chunk = nil
+			if boundary {
+				sc.boundary = true
+				return channeler.Line{}, false
+			}
+		}
+		var (
+			chunk *channeler.Chunk
+			ok    bool
+		)
+		select {
+		case chunk, ok = <-sc.ch:
+		case <-sc.quit:
+		}
+		if !ok {
+			return channeler.Line{}, false
+		}
+		sc.chunk, sc.next = chunk, 0
+		select {
+		case sc.chActivity <- struct{}{}:
+		default:
+		}
+	}
+	line := sc.chunk.Record(sc.next)
+	sc.next++
+	sc.lastSeq = line.Seq
+	if ds != nil {
+		ds.line(line.Text)
+	}
+	return line, true
+}
+
+// nextRaw is like nextLine, but returns the bytes read for all the
+// lines remaining in the current Chunk, line terminators included.
+func (sc *streamCursor) nextRaw(ds *dialogSide) ([]byte, bool) {
+	if _, ok := sc.nextLine(ds); !ok {
+		return nil, false
+	}
+	first := sc.next - 1
+	for sc.next < sc.chunk.Len() {
+		line := sc.chunk.Record(sc.next)
+		sc.next++
+		sc.lastSeq = line.Seq
+		if ds != nil {
+			ds.line(line.Text)
+		}
+	}
+	return sc.chunk.Raw(first), true
+}
+
+// stopped is true if quit has closed.
+func (sc *streamCursor) stopped() bool {
+	select {
+	case <-sc.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// takeBoundary reports, and forgets, whether the last call
+// to nextLine stopped at a boundary rather than a closed stream.
+func (sc *streamCursor) takeBoundary() bool {
+	b := sc.boundary
+	sc.boundary = false
+	return b
+}
@@ -0,0 +1,197 @@
+package shexec
+
+import (
+	"io"
+	"strings"
+)
+
+// TableCommander parses stdOut as a table of whitespace-aligned
+// columns, such as the output of ps, df or "kubectl get".
+// Column positions come from the header line, which is the first
+// non-blank line after SkipLines.
+//
+// A cell is the text under its column's header, up to the start of
+// the next column, so cells may contain spaces, or be empty.  A word
+// straddling that boundary, e.g. a right-aligned number wider than
+// its header, goes to the column on the right unless it overlaps the
+// text of the header on the left.  The last column takes the rest
+// of the line.
+//
+// T is either map[string]string, keyed by column name, or a struct
+// whose fields are matched to columns by a `shexec` tag holding a
+// column index or name, else by field name, ignoring case
+// (see tagKey).
+//
+// Rows that cannot be parsed don't fail the call to Run; they're
+// reported by Err.
+// Each Run replaces the results of the previous one.
+type TableCommander[T any] struct {
+	C string
+	// Columns optionally names the columns to find in the header,
+	// for headers such as "Mounted on" that contain spaces.
+	// If empty, each word in the header is a column name.
+	Columns []string
+	// SkipLines is the number of leading lines to ignore.
+	SkipLines int
+
+	header []tableColumn
+	rows   []T
+	errs   parseErrors
+}
+
+// NewTableCommander returns an instance of TableCommander.
+func NewTableCommander[T any](c string) *TableCommander[T] {
+	return &TableCommander[T]{C: c}
+}
+
+func (c *TableCommander[T]) Command() string          { return c.C }
+func (c *TableCommander[T]) ParseErr() io.WriteCloser { return DevNull }
+func (c *TableCommander[T]) ParseOut() io.WriteCloser {
+	c.header, c.rows, c.errs = nil, nil, nil
+	return &tableParser[T]{c: c}
+}
+
+// Rows returns the rows parsed.
+func (c *TableCommander[T]) Rows() []T { return c.rows }
+
+// ColumnNames returns the column names found in the header.
+func (c *TableCommander[T]) ColumnNames() []string {
+	names := make([]string, len(c.header))
+	for i, col := range c.header {
+		names[i] = col.name
+	}
+	return names
+}
+
+// Err returns an error for each row that could not be parsed,
+// and for a header missing any of Columns.
+func (c *TableCommander[T]) Err() error { return c.errs.err() }
+
+// Result returns the rows parsed, and the error from Err.
+func (c *TableCommander[T]) Result() ([]T, error) { return c.rows, c.Err() }
+
+// tableColumn locates a column name in a header.
+type tableColumn struct {
+	name       string
+	start, end int
+}
+
+// parseHeader returns the columns in the header line.
+func (c *TableCommander[T]) parseHeader(
+	line int, text string) (cols []tableColumn) {
+	if len(c.Columns) == 0 {
+		for i := 0; i < len(text); {
+			for i < len(text) && isBlank(text[i]) {
+				i++
+			}
+			j := i
+			for j < len(text) && !isBlank(text[j]) {
+				j++
+			}
+			if j > i {
+				cols = append(cols, tableColumn{text[i:j], i, j})
+			}
+			i = j
+		}
+		return cols
+	}
+	from := 0
+	for _, name := range c.Columns {
+		i := strings.Index(text[from:], name)
+		if i < 0 {
+			c.errs.add(line, text, &missingColumnError{name})
+			return nil
+		}
+		i += from
+		from = i + len(name)
+		cols = append(cols, tableColumn{name, i, from})
+	}
+	return cols
+}
+
+// splitRow cuts the text into cells.
+func (c *TableCommander[T]) splitRow(text string) []string {
+	cells := make([]string, len(c.header))
+	left := 0
+	for i := range c.header {
+		right := len(text)
+		if i+1 < len(c.header) {
+			right = c.cut(text, i+1)
+		}
+		right = max(left, right)
+		if left < len(text) {
+			cells[i] = strings.TrimSpace(text[left:min(right, len(text))])
+		}
+		left = right
+	}
+	return cells
+}
+
+// cut returns the position in the text where the given
+// column, which isn't the first, starts.  Such a column may
+// still start at zero, e.g. if the first of Columns is empty.
+func (c *TableCommander[T]) cut(text string, col int) int {
+	b := c.header[col].start
+	if b == 0 || b >= len(text) || isBlank(text[b]) || isBlank(text[b-1]) {
+		return b
+	}
+	// A word straddles the boundary.
+	start := b
+	for start > 0 && !isBlank(text[start-1]) {
+		start--
+	}
+	if start >= c.header[col-1].end {
+		return start
+	}
+	end := b
+	for end < len(text) && !isBlank(text[end]) {
+		end++
+	}
+	return end
+}
+
+func isBlank(b byte) bool { return b == ' ' || b == '\t' }
+
+type missingColumnError struct{ name string }
+
+func (e *missingColumnError) Error() string {
+	return "header lacks column " + e.name
+}
+
+// tableParser hands each line to a TableCommander.
+type tableParser[T any] struct {
+	c    *TableCommander[T]
+	line int
+	// gotHeader is true once the header line has been seen.
+	gotHeader bool
+	names     []string
+}
+
+func (tp *tableParser[T]) Write(data []byte) (int, error) {
+	tp.line++
+	text := strings.TrimRight(string(data), " \t")
+	if tp.line <= tp.c.SkipLines || text == "" {
+		return len(data), nil
+	}
+	c := tp.c
+	if !tp.gotHeader {
+		tp.gotHeader = true
+		c.header = c.parseHeader(tp.line, text)
+		tp.names = c.ColumnNames()
+		return len(data), nil
+	}
+	if len(c.header) == 0 {
+		// The header was bad; rows would be misread.
+		return len(data), nil
+	}
+	row, err := decodeRecord[T](
+		&record{values: c.splitRow(text), names: tp.names})
+	if err != nil {
+		c.errs.add(tp.line, text, err)
+		return len(data), nil
+	}
+	c.rows = append(c.rows, row)
+	return len(data), nil
+}
+
+func (tp *tableParser[T]) Close() error { return nil }
@@ -0,0 +1,89 @@
+package shexec_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/monopole/shexec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableCommander(t *testing.T) {
+	sh := NewShell(makeBinShParams())
+	assert.NoError(t, sh.Start(timeOutShort))
+	defer func() { assert.NoError(t, sh.Stop(timeOutShort, "")) }()
+
+	type proc struct {
+		PID     int
+		TTY     string
+		Command string `shexec:"CMD"`
+	}
+	ps := NewTableCommander[proc](`cat <<'EOF'
+    PID TTY          TIME CMD
+      1 ?        00:00:03 init --system
+ 123456 pts/0    00:00:00 sh
+    oops pts/1   00:00:00 sh
+EOF`)
+	assert.NoError(t, sh.Run(timeOutShort, ps))
+	assert.Equal(t, []string{"PID", "TTY", "TIME", "CMD"}, ps.ColumnNames())
+	assert.Equal(t, []proc{
+		{1, "?", "init --system"},
+		{123456, "pts/0", "sh"},
+	}, ps.Rows())
+	var pe *ParseError
+	if assert.True(t, errors.As(ps.Err(), &pe)) {
+		assert.Equal(t, 4, pe.Line)
+	}
+
+	df := NewTableCommander[map[string]string](`cat <<'EOF'
+Filesystem              1K-blocks     Used Available Use% Mounted on
+/dev/mapper/vg-root     102687672 51245224  46183620  53% /
+tmpfs                123456789012       0  16384000   0% /dev/shm
+EOF`)
+	df.Columns = []string{
+		"Filesystem", "1K-blocks", "Used", "Available", "Use%", "Mounted on"}
+	assert.NoError(t, sh.Run(timeOutShort, df))
+	assert.NoError(t, df.Err())
+	assert.Equal(t, []map[string]string{{
+		"Filesystem": "/dev/mapper/vg-root", "1K-blocks": "102687672",
+		"Used": "51245224", "Available": "46183620", "Use%": "53%",
+		"Mounted on": "/",
+	}, {
+		"Filesystem": "tmpfs", "1K-blocks": "123456789012",
+		"Used": "0", "Available": "16384000", "Use%": "0%",
+		"Mounted on": "/dev/shm",
+	}}, df.Rows())
+
+	type pod struct {
+		Name     string
+		Ready    string
+		Restarts int
+		Age      string
+		Node     string
+	}
+	k := NewTableCommander[pod](`cat <<'EOF'
+Listing pods
+NAME        READY   RESTARTS   AGE   NODE
+web-1       1/1     0          5d    node a
+web-2       0/1     12         10m
+EOF`)
+	k.SkipLines = 1
+	assert.NoError(t, sh.Run(timeOutShort, k))
+	assert.NoError(t, k.Err())
+	assert.Equal(t, []pod{
+		{"web-1", "1/1", 0, "5d", "node a"},
+		{"web-2", "0/1", 12, "10m", ""},
+	}, k.Rows())
+
+	// A column starting at zero needn't be the first.
+	z := NewTableCommander[map[string]string](`printf 'A B\nxy z\n'`)
+	z.Columns = []string{"", "A"}
+	assert.NoError(t, sh.Run(timeOutShort, z))
+	assert.NoError(t, z.Err())
+	assert.Equal(t, []map[string]string{{"0": "", "A": "xy z"}}, z.Rows())
+
+	k.Columns = []string{"NAME", "STATUS"}
+	assert.NoError(t, sh.Run(timeOutShort, k))
+	assert.ErrorContains(t, k.Err(), "header lacks column STATUS")
+	assert.Empty(t, k.Rows())
+}
@@ -0,0 +1,216 @@
+// Package transfer moves files through a shell session, for shells,
+// e.g. remote or containerized ones, offering no other way to do so.
+//
+// It needs a POSIX shell with base64 (as in GNU coreutils or busybox),
+// dd and cksum.  Files move in chunks, one command per chunk, each run
+// with the given timeout, and the result is verified with cksum.
+package transfer
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/monopole/shexec"
+	"github.com/monopole/shexec/quote"
+)
+
+const (
+	// transferChunkSize is the most file bytes moved per command.
+	// It's a multiple of 3, so chunks encode without base64 padding.
+	transferChunkSize = 48 * 1024
+
+	// transferLineLen is the length of a line of base64 sent to
+	// the shell, short enough for any terminal line discipline.
+	transferLineLen = 76
+
+	// transferEOF ends a here-doc of base64.
+	// It can't be mistaken for base64, as it has underscores.
+	transferEOF = "SHEXEC_TRANSFER_EOF"
+)
+
+// Upload copies the local file to remotePath, replacing any file there.
+func Upload(
+	sh shexec.Shell, d time.Duration, localPath, remotePath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("opening %q for upload; %w", localPath, err)
+	}
+	defer f.Close()
+	remote := quote.Sh.Quote(remotePath)
+	var (
+		sum cksum
+		buf = make([]byte, transferChunkSize)
+	)
+	// An empty file still takes one command, to create it.
+	for redirect := ">"; ; redirect = ">>" {
+		n, err := io.ReadFull(f, buf)
+		if err != nil &&
+			!errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("reading %q for upload; %w", localPath, err)
+		}
+		if n == 0 && redirect == ">>" {
+			break
+		}
+		_, _ = sum.Write(buf[:n])
+		rc := shexec.NewRecallCommander(fmt.Sprintf(
+			"base64 -d %s %s <<'%s'", redirect, remote, transferEOF))
+		if err = runTransfer(sh, d, &shexec.PayloadCommander{
+			Commander:  rc,
+			Data:       strings.NewReader(encodeLines(buf[:n])),
+			Terminator: transferEOF,
+		}, rc); err != nil {
+			return fmt.Errorf("uploading to %q; %w", remotePath, err)
+		}
+		if n < len(buf) {
+			break
+		}
+	}
+	return verifyTransfer(sh, d, remotePath, &sum)
+}
+
+// Download writes the contents of the file at remotePath to w.
+// If the returned error comes from verification, w has already
+// been given the contents, which are wrong.
+func Download(
+	sh shexec.Shell, d time.Duration, remotePath string, w io.Writer) error {
+	size, _, err := remoteCksum(sh, d, remotePath)
+	if err != nil {
+		return err
+	}
+	remote := quote.Sh.Quote(remotePath)
+	var sum cksum
+	out := io.MultiWriter(w, &sum)
+	for i := int64(0); i*transferChunkSize < size; i++ {
+		rc := shexec.NewRecallCommander(fmt.Sprintf(
+			"dd if=%s bs=%d skip=%d count=1 2>/dev/null | base64",
+			remote, transferChunkSize, i))
+		if err = runTransfer(sh, d, rc, rc); err != nil {
+			return fmt.Errorf("downloading %q; %w", remotePath, err)
+		}
+		data, err := base64.StdEncoding.DecodeString(
+			strings.Join(rc.DataOut(), ""))
+		if err != nil {
+			return fmt.Errorf("decoding chunk %d of %q; %w", i, remotePath, err)
+		}
+		want := min(transferChunkSize, size-i*transferChunkSize)
+		if int64(len(data)) != want {
+			return fmt.Errorf( //nolint:goerr113
+				"chunk %d of %q has %d bytes, expected %d",
+				i, remotePath, len(data), want)
+		}
+		if _, err = out.Write(data); err != nil {
+			return fmt.Errorf("writing download of %q; %w", remotePath, err)
+		}
+	}
+	return verifyTransfer(sh, d, remotePath, &sum)
+}
+
+// runTransfer runs a transfer command, failing if
+// it wrote anything to stdErr, as recorded in rc.
+func runTransfer(sh shexec.Shell, d time.Duration,
+	c shexec.Commander, rc *shexec.RecallCommander) error {
+	if err := sh.Run(d, c); err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+	if errs := rc.DataErr(); len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; ")) //nolint:goerr113
+	}
+	return nil
+}
+
+// verifyTransfer compares the remote file's checksum to the local one.
+func verifyTransfer(
+	sh shexec.Shell, d time.Duration, remotePath string, local *cksum) error {
+	size, crc, err := remoteCksum(sh, d, remotePath)
+	if err != nil {
+		return err
+	}
+	if size != local.n || crc != local.Sum() {
+		return fmt.Errorf( //nolint:goerr113
+			"checksum mismatch on %q; "+
+				"remote %d (%d bytes), local %d (%d bytes)",
+			remotePath, crc, size, local.Sum(), local.n)
+	}
+	return nil
+}
+
+// remoteCksum returns the size and checksum of a remote file.
+func remoteCksum(sh shexec.Shell, d time.Duration,
+	remotePath string) (int64, uint32, error) {
+	rc := shexec.NewRecallCommander("cksum < " + quote.Sh.Quote(remotePath))
+	if err := runTransfer(sh, d, rc, rc); err != nil {
+		return 0, 0, fmt.Errorf("checksumming %q; %w", remotePath, err)
+	}
+	var (
+		crc  uint32
+		size int64
+	)
+	if out := rc.DataOut(); len(out) != 1 {
+		return 0, 0, fmt.Errorf( //nolint:goerr113
+			"unexpected cksum output %q", out)
+	} else if _, err := fmt.Sscanf(out[0], "%d %d", &crc, &size); err != nil {
+		return 0, 0, fmt.Errorf("unexpected cksum output %q; %w", out[0], err)
+	}
+	return size, crc, nil
+}
+
+// encodeLines returns data in base64, in lines of transferLineLen.
+func encodeLines(data []byte) string {
+	enc := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	for len(enc) > transferLineLen {
+		b.WriteString(enc[:transferLineLen])
+		b.WriteByte('\n')
+		enc = enc[transferLineLen:]
+	}
+	b.WriteString(enc)
+	return b.String()
+}
+
+// cksumPoly is the CRC polynomial used by cksum.
+const cksumPoly = 0x04C11DB7
+
+// nolint:gochecknoglobals
+var cksumTable = func() (t [256]uint32) {
+	for i := range t {
+		c := uint32(i) << 24
+		for range 8 {
+			if c&(1<<31) != 0 {
+				c = c<<1 ^ cksumPoly
+			} else {
+				c <<= 1
+			}
+		}
+		t[i] = c
+	}
+	return t
+}()
+
+// cksum computes what the POSIX cksum utility does.
+type cksum struct {
+	crc uint32
+	n   int64
+}
+
+func (c *cksum) Write(data []byte) (int, error) {
+	for _, b := range data {
+		c.crc = c.crc<<8 ^ cksumTable[byte(c.crc>>24)^b]
+	}
+	c.n += int64(len(data))
+	return len(data), nil
+}
+
+// Sum returns the checksum, which includes the length of the data.
+func (c *cksum) Sum() uint32 {
+	crc := c.crc
+	for n := c.n; n != 0; n >>= 8 {
+		crc = crc<<8 ^ cksumTable[byte(crc>>24)^byte(n)]
+	}
+	return ^crc
+}
@@ -0,0 +1,54 @@
+package transfer_test
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/monopole/shexec"
+	"github.com/monopole/shexec/mdrun"
+	. "github.com/monopole/shexec/transfer"
+	"github.com/stretchr/testify/assert"
+)
+
+const timeout = 5 * time.Second
+
+func TestUploadDownload(t *testing.T) {
+	sh := shexec.NewShell(mdrun.ShellParameters("/bin/sh"))
+	assert.NoError(t, sh.Start(timeout))
+	dir := t.TempDir()
+	rnd := rand.New(rand.NewSource(1))
+	for _, size := range []int{0, 1, 3, 48*1024 - 1, 48 * 1024, 100000} {
+		data := make([]byte, size)
+		rnd.Read(data)
+		local := filepath.Join(dir, "local")
+		assert.NoError(t, os.WriteFile(local, data, 0o600))
+		// A name needing quotes.
+		remote := filepath.Join(dir, "it's remote")
+
+		assert.NoError(t, Upload(sh, timeout, local, remote), size)
+		got, err := os.ReadFile(remote)
+		assert.NoError(t, err)
+		assert.Equal(t, string(data), string(got), size)
+
+		var b bytes.Buffer
+		assert.NoError(t, Download(sh, timeout, remote, &b), size)
+		assert.Equal(t, string(data), b.String(), size)
+	}
+
+	// Failures leave the shell usable.
+	var b bytes.Buffer
+	err := Download(sh, timeout, filepath.Join(dir, "missing"), &b)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "missing")
+	}
+	err = Upload(sh, timeout,
+		filepath.Join(dir, "local"), filepath.Join(dir, "no", "such"))
+	assert.Error(t, err)
+	err = Upload(sh, timeout, filepath.Join(dir, "missing"), "x")
+	assert.Error(t, err)
+	assert.NoError(t, sh.Stop(timeout, ""))
+}
@@ -0,0 +1,52 @@
+package shexec_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	. "github.com/monopole/shexec"
+	"github.com/monopole/shexec/channeler"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeShell knows "echo" and "warn", which write their
+// argument to stdOut and stdErr respectively.
+func fakeShell(stdIn io.Reader, stdOut, stdErr io.Writer) error {
+	sc := bufio.NewScanner(stdIn)
+	for sc.Scan() {
+		cmd, arg, _ := strings.Cut(sc.Text(), " ")
+		switch cmd {
+		case "echo":
+			fmt.Fprintln(stdOut, arg)
+		case "warn":
+			fmt.Fprintln(stdErr, arg)
+		default:
+			fmt.Fprintf(stdErr, "%s: not found\n", cmd)
+		}
+	}
+	return sc.Err()
+}
+
+func TestInProcessShell(t *testing.T) {
+	sh := NewShell(Parameters{
+		Params: channeler.Params{
+			Transport: &channeler.PipeTransport{Serve: fakeShell},
+		},
+		SentinelOut: Sentinel{C: "echo " + unlikelyStdOut, V: unlikelyStdOut},
+		SentinelErr: Sentinel{C: "warn " + unlikelyStdErr, V: unlikelyStdErr},
+	})
+	assert.NoError(t, sh.Start(timeOutShort))
+	c := NewRecallCommander("echo hello")
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	assert.Equal(t, []string{"hello"}, c.DataOut())
+	assert.Empty(t, c.DataErr())
+
+	c = NewRecallCommander("ls")
+	assert.NoError(t, sh.Run(timeOutShort, c))
+	assert.Empty(t, c.DataOut())
+	assert.Equal(t, []string{"ls: not found"}, c.DataErr())
+	assert.NoError(t, sh.Stop(timeOutShort, ""))
+}